@@ -0,0 +1,547 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// generate returns the source of a file with EncodeRLP and DecodeRLP
+// methods for the named struct types of the package in dir. The file the
+// output goes to, if any, is skipped when parsing the package, so that
+// methods generated earlier don't get in the way.
+func generate(dir string, typeNames []string, outFile string) ([]byte, error) {
+	fset := token.NewFileSet()
+	filter := func(fi os.FileInfo) bool {
+		name := fi.Name()
+		return !strings.HasSuffix(name, "_test.go") && (outFile == "" || name != filepath.Base(outFile))
+	}
+	pkgs, err := parser.ParseDir(fset, dir, filter, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected one package in %s, found %d", dir, len(pkgs))
+	}
+
+	var pkg *pkgInfo
+	for _, p := range pkgs {
+		pkg = newPkgInfo(fset, p)
+	}
+
+	r := newResolver(pkg)
+	g := &generator{imports: make(map[string]string)}
+	for _, name := range typeNames {
+		t, err := r.resolveRoot(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := g.genType(t, r.imports); err != nil {
+			return nil, fmt.Errorf("type %s: %v", name, err)
+		}
+	}
+
+	return g.file(pkg.name)
+}
+
+// generator accumulates the methods of a generated file.
+type generator struct {
+	body bytes.Buffer
+	// imports maps the import names used by the generated code to paths.
+	imports map[string]string
+	// known maps the import names seen in resolved types to paths.
+	known map[string]string
+	tmp   int
+}
+
+func (g *generator) file(pkgName string) ([]byte, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by rlpgen. DO NOT EDIT.\n\npackage %s\n\n", pkgName)
+
+	// Standard library imports go first, like goimports has it.
+	std, other := []string{"io"}, []string{rlpPath}
+	names := map[string]string{}
+	for name, p := range g.imports {
+		switch {
+		case p == "io" || p == rlpPath:
+			continue
+		case strings.Contains(strings.SplitN(p, "/", 2)[0], "."):
+			other = append(other, p)
+		default:
+			std = append(std, p)
+		}
+		names[p] = name
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+
+	fmt.Fprintf(&out, "import (\n")
+	for i, group := range [][]string{std, other} {
+		if i > 0 {
+			fmt.Fprintf(&out, "\n")
+		}
+		for _, p := range group {
+			if name := names[p]; name != "" && name != path.Base(p) {
+				fmt.Fprintf(&out, "\t%s %q\n", name, p)
+			} else {
+				fmt.Fprintf(&out, "\t%q\n", p)
+			}
+		}
+	}
+	fmt.Fprintf(&out, ")\n\n")
+	out.Write(g.body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid code: %v\n%s", err, out.Bytes())
+	}
+	return src, nil
+}
+
+func (g *generator) p(format string, args ...interface{}) {
+	fmt.Fprintf(&g.body, format+"\n", args...)
+}
+
+func (g *generator) newTmp() string {
+	g.tmp++
+	return fmt.Sprintf("_tmp%d", g.tmp)
+}
+
+// typeName returns the name of t for use in the generated code.
+func (g *generator) typeName(t *rlpType) string {
+	for _, name := range t.pkgs {
+		g.imports[name] = g.known[name]
+	}
+	return t.name
+}
+
+func (g *generator) genType(t *rlpType, known map[string]string) error {
+	g.known = known
+	g.tmp = 0
+
+	g.p("// EncodeRLP implements rlp.Encoder.")
+	g.p("func (obj *%s) EncodeRLP(_w io.Writer) error {", t.name)
+	g.p("w := rlp.NewEncoderBuffer(_w)")
+	g.p("if obj == nil {")
+	g.p("w.ListEnd(w.List())")
+	g.p("return w.Flush()")
+	g.p("}")
+	if err := g.encodeStruct(t, "obj"); err != nil {
+		return err
+	}
+	g.p("return w.Flush()")
+	g.p("}\n")
+
+	g.tmp = 0
+	g.p("// DecodeRLP implements rlp.Decoder.")
+	g.p("func (obj *%s) DecodeRLP(dec *rlp.Stream) error {", t.name)
+	if err := g.decodeStruct(t, "obj"); err != nil {
+		return err
+	}
+	g.p("return nil")
+	g.p("}\n")
+	return nil
+}
+
+// addr returns the address of the addressable expression v.
+func addr(v string) string {
+	if strings.HasPrefix(v, "(*") && strings.HasSuffix(v, ")") {
+		return v[2 : len(v)-1]
+	}
+	return "&" + v
+}
+
+// deref returns the value the pointer expression v points to.
+func deref(v string) string {
+	return "(*" + v + ")"
+}
+
+// field returns the field name of the struct expression v.
+func field(v, name string) string {
+	if strings.HasPrefix(v, "(*") && strings.HasSuffix(v, ")") {
+		// Selectors dereference pointers themselves.
+		v = v[2 : len(v)-1]
+	}
+	return v + "." + name
+}
+
+// conv converts v to the type named to, unless it's of that type already.
+func conv(to, from, v string) string {
+	if to == from {
+		return v
+	}
+	if strings.HasPrefix(v, "(") && strings.HasSuffix(v, ")") {
+		return to + v
+	}
+	return to + "(" + v + ")"
+}
+
+// encode writes the statements encoding v, an addressable expression of
+// type t.
+func (g *generator) encode(t *rlpType, v string) error {
+	switch t.kind {
+	case kindUint:
+		g.p("w.WriteUint64(%s)", conv("uint64", t.name, v))
+	case kindBool:
+		g.p("w.WriteBool(%s)", conv("bool", t.name, v))
+	case kindString:
+		g.p("w.WriteString(%s)", conv("string", t.name, v))
+	case kindBytes:
+		g.p("w.WriteBytes(%s)", conv("[]byte", t.name, v))
+	case kindByteArray:
+		g.p("w.WriteBytes(%s[:])", v)
+	case kindBigInt:
+		g.p("if err := w.WriteBigInt(%s); err != nil {", addr(v))
+		g.p("return err")
+		g.p("}")
+	case kindBigIntPtr:
+		g.p("if err := w.WriteBigInt(%s); err != nil {", v)
+		g.p("return err")
+		g.p("}")
+	case kindUint256:
+		g.p("w.WriteUint256(%s)", addr(v))
+	case kindRaw:
+		g.p("w.Write(%s)", v)
+	case kindSlice, kindArray:
+		list, i := g.newTmp(), g.newTmp()
+		g.p("%s := w.List()", list)
+		g.p("for %s := range %s {", i, v)
+		if err := g.encode(t.elem, v+"["+i+"]"); err != nil {
+			return err
+		}
+		g.p("}")
+		g.p("w.ListEnd(%s)", list)
+	case kindPtr:
+		return g.encodePtr(t, v)
+	case kindStruct:
+		return g.encodeStruct(t, v)
+	case kindReflect:
+		g.p("if err := w.Encode(%s); err != nil {", addr(v))
+		g.p("return err")
+		g.p("}")
+	default:
+		return fmt.Errorf("can't encode %s", t.name)
+	}
+
+	return nil
+}
+
+// encodePtr writes the statements encoding the pointer v. A nil pointer is
+// the empty value of the element's kind.
+func (g *generator) encodePtr(t *rlpType, v string) error {
+	g.p("if %s == nil {", v)
+	g.writeEmpty(t.elem.nilKind)
+	g.p("} else {")
+	var err error
+	if t.kind == kindPtr {
+		err = g.encode(t.elem, deref(v))
+	} else {
+		err = g.encode(t, v)
+	}
+	g.p("}")
+	return err
+}
+
+func (g *generator) writeEmpty(nilKind string) {
+	if nilKind == "List" {
+		g.p("w.ListEnd(w.List())")
+	} else {
+		g.p("w.WriteBytes(nil)")
+	}
+}
+
+func (g *generator) encodeStruct(t *rlpType, v string) error {
+	list := g.newTmp()
+	g.p("%s := w.List()", list)
+
+	// Trailing optional fields are left out as long as they, and all
+	// fields after them, are zero.
+	first := len(t.fields)
+	for i, f := range t.fields {
+		if f.optional {
+			first = i
+			break
+		}
+	}
+	nonZero := make([]string, len(t.fields))
+	for i := first; i < len(t.fields); i++ {
+		f := t.fields[i]
+		cond, err := g.nonZeroCheck(f.typ, field(v, f.name))
+		if f.tail {
+			// A tail without elements is absent, nil or not.
+			cond, err = "len("+field(v, f.name)+") != 0", nil
+		}
+		if err != nil {
+			return fmt.Errorf("optional field %s: %v", f.name, err)
+		}
+		nonZero[i] = g.newTmp()
+		g.p("%s := %s", nonZero[i], cond)
+	}
+
+	for i, f := range t.fields {
+		fv := field(v, f.name)
+		if i >= first {
+			g.p("if %s {", strings.Join(nonZero[i:], " || "))
+		}
+
+		var err error
+		switch {
+		case f.tail:
+			idx := g.newTmp()
+			g.p("for %s := range %s {", idx, fv)
+			err = g.encode(f.typ.elem, fv+"["+idx+"]")
+			g.p("}")
+		case f.nilOK:
+			err = g.encodePtr(f.typ, fv)
+		default:
+			err = g.encode(f.typ, fv)
+		}
+		if err != nil {
+			return fmt.Errorf("field %s: %v", f.name, err)
+		}
+
+		if i >= first {
+			g.p("}")
+		}
+	}
+
+	g.p("w.ListEnd(%s)", list)
+	return nil
+}
+
+// nonZeroCheck returns an expression that is true if v isn't the zero value
+// of t.
+func (g *generator) nonZeroCheck(t *rlpType, v string) (string, error) {
+	switch {
+	case t.kind == kindUint:
+		return v + " != 0", nil
+	case t.kind == kindBool:
+		return conv("bool", t.name, v), nil
+	case t.kind == kindString:
+		return v + ` != ""`, nil
+	case t.kind == kindUint256:
+		return "!" + v + ".IsZero()", nil
+	case t.isPtr, t.kind == kindBytes, t.kind == kindRaw, t.kind == kindSlice,
+		t.kind == kindReflect && (t.name == "interface{}" || t.name == "any"):
+		return v + " != nil", nil
+	case t.kind == kindByteArray, t.kind == kindArray && comparable(t.elem):
+		return v + " != (" + g.typeName(t) + "{})", nil
+	}
+
+	return "", fmt.Errorf("type %s can't be optional", t.name)
+}
+
+func comparable(t *rlpType) bool {
+	switch t.kind {
+	case kindUint, kindBool, kindString, kindByteArray, kindUint256, kindPtr, kindBigIntPtr:
+		return true
+	case kindArray:
+		return comparable(t.elem)
+	}
+	return false
+}
+
+// zeroValue returns the zero value of t, which may be optional.
+func (g *generator) zeroValue(t *rlpType) string {
+	switch {
+	case t.kind == kindUint:
+		return "0"
+	case t.kind == kindBool:
+		return "false"
+	case t.kind == kindString:
+		return `""`
+	case t.kind == kindByteArray, t.kind == kindArray, t.kind == kindUint256:
+		return g.typeName(t) + "{}"
+	}
+	return "nil"
+}
+
+// decode writes the statements decoding into v, an addressable expression
+// of type t.
+func (g *generator) decode(t *rlpType, v string) error {
+	switch t.kind {
+	case kindUint:
+		tmp := g.newTmp()
+		g.p("%s, err := dec.Uint64()", tmp)
+		g.p("if err != nil {")
+		g.p("return err")
+		g.p("}")
+		if t.basic != "uint64" {
+			g.p("if uint64(%s(%s)) != %s {", t.basic, tmp, tmp)
+			g.p("return rlp.ErrValueTooLarge")
+			g.p("}")
+		}
+		g.p("%s = %s", v, conv(t.name, "uint64", tmp))
+	case kindBool:
+		g.readInto(v, "dec.Bool()", conv(g.typeName(t), "bool", "%s"))
+	case kindString:
+		g.readInto(v, "dec.Bytes()", g.typeName(t)+"(%s)")
+	case kindBytes:
+		// Named byte slices are assignable from []byte.
+		g.readInto(v, "dec.Bytes()", "%s")
+	case kindRaw:
+		g.readInto(v, "dec.Raw()", "%s")
+	case kindBigIntPtr:
+		g.readInto(v, "dec.BigInt()", "%s")
+	case kindByteArray:
+		tmp := g.newTmp()
+		g.p("%s, err := dec.Bytes()", tmp)
+		g.p("if err != nil {")
+		g.p("return err")
+		g.p("}")
+		g.p("if len(%s) != len(%s) {", tmp, v)
+		g.p("return rlp.ErrByteArrayLength")
+		g.p("}")
+		g.p("copy(%s[:], %s)", v, tmp)
+	case kindBigInt:
+		tmp := g.newTmp()
+		g.p("%s, err := dec.BigInt()", tmp)
+		g.p("if err != nil {")
+		g.p("return err")
+		g.p("}")
+		g.p("%s.Set(%s)", v, tmp)
+	case kindUint256:
+		g.p("if err := dec.ReadUint256(%s); err != nil {", addr(v))
+		g.p("return err")
+		g.p("}")
+	case kindSlice:
+		g.p("if _, err := dec.List(); err != nil {")
+		g.p("return err")
+		g.p("}")
+		if err := g.decodeElems(t, v); err != nil {
+			return err
+		}
+		g.p("if err := dec.ListEnd(); err != nil {")
+		g.p("return err")
+		g.p("}")
+	case kindArray:
+		i := g.newTmp()
+		g.p("if _, err := dec.List(); err != nil {")
+		g.p("return err")
+		g.p("}")
+		g.p("for %s := 0; %s < len(%s); %s++ {", i, i, v, i)
+		if err := g.decode(t.elem, v+"["+i+"]"); err != nil {
+			return err
+		}
+		g.p("}")
+		g.p("if err := dec.ListEnd(); err != nil {")
+		g.p("return err")
+		g.p("}")
+	case kindPtr:
+		g.p("if %s == nil {", v)
+		g.p("%s = new(%s)", v, g.typeName(t.elem))
+		g.p("}")
+		return g.decode(t.elem, deref(v))
+	case kindStruct:
+		return g.decodeStruct(t, v)
+	case kindReflect:
+		g.p("if err := dec.Decode(%s); err != nil {", addr(v))
+		g.p("return err")
+		g.p("}")
+	default:
+		return fmt.Errorf("can't decode %s", t.name)
+	}
+
+	return nil
+}
+
+// readInto writes the statements assigning the result of read to v. The
+// result is converted by the format string convert.
+func (g *generator) readInto(v, read, convert string) {
+	tmp := g.newTmp()
+	g.p("%s, err := %s", tmp, read)
+	g.p("if err != nil {")
+	g.p("return err")
+	g.p("}")
+	g.p("%s = "+convert, v, tmp)
+}
+
+// decodeElems writes the statements collecting the remaining elements of
+// the current list into the slice v.
+func (g *generator) decodeElems(t *rlpType, v string) error {
+	list, elem := g.newTmp(), g.newTmp()
+	g.p("%s := %s{}", list, g.typeName(t))
+	g.p("for dec.MoreDataInList() {")
+	g.p("var %s %s", elem, g.typeName(t.elem))
+	if err := g.decode(t.elem, elem); err != nil {
+		return err
+	}
+	g.p("%s = append(%s, %s)", list, list, elem)
+	g.p("}")
+	g.p("%s = %s", v, list)
+	return nil
+}
+
+// decodeNilPtr writes the statements decoding into the pointer v of an
+// rlp:"nil" field. The empty value of the element's kind makes it nil.
+func (g *generator) decodeNilPtr(t *rlpType, v string) error {
+	kind, size := g.newTmp(), g.newTmp()
+	g.p("%s, %s, err := dec.Kind()", kind, size)
+	g.p("if err != nil {")
+	g.p("return err")
+	g.p("}")
+	g.p("if %s == rlp.%s && %s == 0 {", kind, t.elem.nilKind, size)
+	if t.elem.nilKind == "List" {
+		g.p("if _, err := dec.List(); err != nil {")
+		g.p("return err")
+		g.p("}")
+		g.p("if err := dec.ListEnd(); err != nil {")
+		g.p("return err")
+		g.p("}")
+	} else {
+		g.p("if _, err := dec.Bytes(); err != nil {")
+		g.p("return err")
+		g.p("}")
+	}
+	g.p("%s = nil", v)
+	g.p("} else {")
+	if err := g.decode(t, v); err != nil {
+		return err
+	}
+	g.p("}")
+	return nil
+}
+
+func (g *generator) decodeStruct(t *rlpType, v string) error {
+	g.p("if _, err := dec.List(); err != nil {")
+	g.p("return err")
+	g.p("}")
+
+	for _, f := range t.fields {
+		fv := field(v, f.name)
+		if f.optional {
+			g.p("if dec.MoreDataInList() {")
+		}
+
+		var err error
+		switch {
+		case f.tail:
+			err = g.decodeElems(f.typ, fv)
+		case f.nilOK:
+			err = g.decodeNilPtr(f.typ, fv)
+		default:
+			err = g.decode(f.typ, fv)
+		}
+		if err != nil {
+			return fmt.Errorf("field %s: %v", f.name, err)
+		}
+
+		if f.optional {
+			g.p("} else {")
+			g.p("%s = %s", fv, g.zeroValue(f.typ))
+			g.p("}")
+		}
+	}
+
+	g.p("if err := dec.ListEnd(); err != nil {")
+	g.p("return err")
+	g.p("}")
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGeneratedUpToDate checks that the checked-in methods of package
+// gentest, which are tested against the reflective codec there, are what
+// the generator produces.
+func TestGeneratedUpToDate(t *testing.T) {
+	dir := filepath.Join("internal", "gentest")
+	want, err := os.ReadFile(filepath.Join(dir, "gen_rlp.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := generate(dir, []string{"Everything", "Optional", "Tree", "Pointers"}, "gen_rlp.go")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("gen_rlp.go is out of date, run go generate in %s", dir)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		src, err string
+	}{
+		{"type T uint", "type T is not a struct"},
+		{"type S struct{}", "type T not found"},
+		{"type T struct{ A int }", "field A: type int is not RLP-serializable"},
+		{"type T struct{ A map[string]uint }", "field A: type map[string]uint is not RLP-serializable"},
+		{"type T struct{ A uint `rlp:\"nil\"` }", `invalid struct tag "nil" for A (field is not a pointer)`},
+		{"type T struct{ A []uint `rlp:\"tail\"`; B uint }", `invalid struct tag "tail" for A (must be on last field)`},
+		{"type T struct{ A uint `rlp:\"tail\"` }", `invalid struct tag "tail" for A (field type is not slice)`},
+		{"type T struct{ A uint `rlp:\"optional\"`; B uint }", `struct field B needs "optional" tag because it follows optional field A`},
+		{"type T struct{ A uint `rlp:\"x\"` }", `unknown struct tag "x" on A`},
+		{"type T struct{ A struct{ B uint } `rlp:\"optional\"` }", "optional field A: type struct{ B uint } can't be optional"},
+		{"import x \"example.com/x\"\n\ntype T struct{ A *x.Y `rlp:\"nil\"` }", "can't tell whether x.Y is a string or a list"},
+		{"import \"io\"\n\ntype T struct{ A uint }\n\nfunc (*T) EncodeRLP(io.Writer) error { return nil }", "type T already has an EncodeRLP or DecodeRLP method"},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		src := "package p\n\n" + test.src + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := generate(dir, []string{"T"}, "")
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("source %q:\ngot error %v\nwant %q", test.src, err, test.err)
+		}
+	}
+}
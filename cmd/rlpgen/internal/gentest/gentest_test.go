@@ -0,0 +1,348 @@
+package gentest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rawfalafel/ethereum-toolbox/rlp"
+	"github.com/rawfalafel/ethereum-toolbox/u256"
+)
+
+// The plain types have the fields of the generated ones but no methods, so
+// they go through the reflective codec.
+type (
+	plainEverything Everything
+	plainOptional   Optional
+	plainTree       Tree
+	plainPointers   Pointers
+)
+
+// testCase is a value of a generated type. plain returns the same value
+// as its plain type, and fresh returns new empty values of both.
+type testCase struct {
+	name  string
+	val   interface{}
+	plain func() interface{}
+	fresh func() (gen, plain interface{})
+}
+
+func everythingCase(name string, v *Everything) testCase {
+	return testCase{name, v, func() interface{} { return (*plainEverything)(v) }, func() (interface{}, interface{}) {
+		return new(Everything), new(plainEverything)
+	}}
+}
+
+func optionalCase(name string, v *Optional) testCase {
+	return testCase{name, v, func() interface{} { return (*plainOptional)(v) }, func() (interface{}, interface{}) {
+		return new(Optional), new(plainOptional)
+	}}
+}
+
+func treeCase(name string, v *Tree) testCase {
+	return testCase{name, v, func() interface{} { return (*plainTree)(v) }, func() (interface{}, interface{}) {
+		return new(Tree), new(plainTree)
+	}}
+}
+
+func pointersCase(name string, v *Pointers) testCase {
+	return testCase{name, v, func() interface{} { return (*plainPointers)(v) }, func() (interface{}, interface{}) {
+		return new(Pointers), new(plainPointers)
+	}}
+}
+
+func fullEverything() *Everything {
+	v := &Everything{
+		U8:      0xff,
+		U16:     0x1234,
+		U32:     0x7f,
+		U64:     1 << 63,
+		U:       1024,
+		B:       0x80,
+		N:       Nonce(99),
+		Bool:    true,
+		Flag:    Flag(true),
+		Str:     strings.Repeat("long string ", 10),
+		Bytes:   []byte{0x01},
+		Data:    Data("data"),
+		Short:   [1]byte{0x7f},
+		Big:     new(big.Int).Lsh(big.NewInt(1), 200),
+		U256:    *u256.NewUint256(0x0102),
+		U256Ptr: new(u256.Uint256).SetBytes(bytes.Repeat([]byte{0xff}, 32)),
+		Raw:     rlp.RawValue{0xc2, 0x01, 0x02},
+		Inner:   Inner{A: 1, B: "b"},
+		InnerP:  &Inner{A: 2},
+		NilP:    &Inner{B: "nil"},
+		NilBig:  big.NewInt(0),
+		NilData: &Data{},
+		Nums:    []uint32{0, 1, 0xffffffff},
+		Matrix:  [][]string{{"a"}, {}, {"b", "c"}},
+		Arr:     [3]Inner{{A: 1}, {B: "x"}, {}},
+		Hashes:  [][4]byte{{1, 2, 3, 4}},
+		Coded:   Coded{N: 3},
+		CodedP:  &Coded{N: 4},
+		Any:     []byte("any"),
+		Ignored: 5,
+		private: 6,
+	}
+	v.Hash[31] = 1
+	v.BigVal.SetUint64(12345)
+	v.Anon.X = 7
+	v.Anon.Y = []byte("anon")
+	return v
+}
+
+func fullPointers() *Pointers {
+	e, s, b, in := &Empty{A: 1}, &[]uint{1, 2}, &[]byte{3}, &Inner{A: 4}
+	return &Pointers{Struct: &e, Slice: &s, Bytes: &b, NilStruct: &in}
+}
+
+func testCases() []testCase {
+	return []testCase{
+		everythingCase("Everything/zero", new(Everything)),
+		everythingCase("Everything/full", fullEverything()),
+		optionalCase("Optional/zero", new(Optional)),
+		optionalCase("Optional/B", &Optional{A: 1, B: 2}),
+		optionalCase("Optional/C", &Optional{C: []byte{}}),
+		optionalCase("Optional/D", &Optional{D: &Inner{A: 1}}),
+		optionalCase("Optional/E", &Optional{E: [2]byte{0, 1}}),
+		optionalCase("Optional/emptyTail", &Optional{Tail: []string{}}),
+		optionalCase("Optional/tail", &Optional{B: 1, Tail: []string{"x", "y"}}),
+		treeCase("Tree/leaf", &Tree{Val: 1}),
+		treeCase("Tree/deep", &Tree{
+			Val:      1,
+			Children: []*Tree{{Val: 2}, {Val: 3, Children: []*Tree{{Val: 4}}}},
+			Next:     &Tree{Val: 5, Next: &Tree{}},
+		}),
+		pointersCase("Pointers/nil", new(Pointers)),
+		pointersCase("Pointers/innerNil", &Pointers{
+			Struct:    new(*Empty),
+			Slice:     new(*[]uint),
+			Bytes:     new(*[]byte),
+			NilStruct: new(*Inner),
+		}),
+		pointersCase("Pointers/full", fullPointers()),
+	}
+}
+
+func TestEncodeMatchesReflection(t *testing.T) {
+	for _, test := range testCases() {
+		gen, err := rlp.EncodeToBytes(test.val)
+		if err != nil {
+			t.Errorf("%s: generated encoder failed: %v", test.name, err)
+			continue
+		}
+		want, err := rlp.EncodeToBytes(test.plain())
+		if err != nil {
+			t.Errorf("%s: reflective encoder failed: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(gen, want) {
+			t.Errorf("%s: output mismatch\ngenerated  %X\nreflective %X", test.name, gen, want)
+		}
+	}
+}
+
+func TestDecodeMatchesReflection(t *testing.T) {
+	for _, test := range testCases() {
+		enc, err := rlp.EncodeToBytes(test.plain())
+		if err != nil {
+			t.Fatalf("%s: encoding failed: %v", test.name, err)
+		}
+		checkDecode(t, test, enc)
+	}
+}
+
+// TestRoundTrip decodes canonical encodings and checks that both codecs
+// encode the result to the same bytes.
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		test testCase
+		enc  string
+	}{
+		{optionalCase("Optional/A", nil), "C101"},
+		{optionalCase("Optional/B", nil), "C20102"},
+		{optionalCase("Optional/tail", nil), "C9018080C08200007879"},
+		{pointersCase("Pointers/empty", nil), "C4C0C080C0"},
+	}
+	for _, test := range tests {
+		input := hexBytes(t, test.enc)
+		gen, plain := test.test.fresh()
+		for _, v := range []interface{}{gen, plain} {
+			if err := rlp.DecodeBytes(input, v); err != nil {
+				t.Errorf("%s: decoding into %T failed: %v", test.test.name, v, err)
+				continue
+			}
+			if enc, err := rlp.EncodeToBytes(v); err != nil || !bytes.Equal(enc, input) {
+				t.Errorf("%s: %T encodes to (%X, %v), want %s", test.test.name, v, enc, err, test.enc)
+			}
+		}
+	}
+}
+
+// TestDecodeInvalidFields replaces single fields of an encoded Everything
+// with values that don't fit them.
+func TestDecodeInvalidFields(t *testing.T) {
+	enc, err := rlp.EncodeToBytes(fullEverything())
+	if err != nil {
+		t.Fatalf("encoding failed: %v", err)
+	}
+	var fields []rlp.RawValue
+	if err := rlp.DecodeBytes(enc, &fields); err != nil {
+		t.Fatalf("decoding fields failed: %v", err)
+	}
+
+	tests := []struct {
+		field int
+		item  string
+	}{
+		{0, "820100"},                         // U8 too large
+		{0, "00"},                             // U8 not canonical
+		{1, "83010000"},                       // U16 too large
+		{2, "850100000000"},                   // U32 too large
+		{3, "89010000000000000000"},           // U64 too large
+		{5, "C0"},                             // B not a string
+		{7, "02"},                             // Bool invalid
+		{8, "8100"},                           // Flag invalid
+		{9, "C0"},                             // Str not a string
+		{12, "80"},                            // Hash too short
+		{13, "8101"},                          // Short not canonical
+		{13, "820102"},                        // Short too long
+		{14, "8200FF"},                        // Big not canonical
+		{16, "A1" + strings.Repeat("FF", 33)}, // U256 too large
+		{19, "80"},                            // Inner not a list
+		{19, "C3018080"},                      // Inner too many elements
+		{19, "C101"},                          // Inner too few elements
+		{21, "80"},                            // NilP with the wrong empty value
+		{22, "C0"},                            // NilBig with the wrong empty value
+		{24, "C6850100000000"},                // Nums element too large
+		{26, "C2C0C0"},                        // Arr too short
+		{26, "C4C0C0C0C0"},                    // Arr too long
+		{28, "C20102"},                        // Coded rejects it
+	}
+	for _, test := range tests {
+		input := make([]rlp.RawValue, len(fields))
+		copy(input, fields)
+		input[test.field] = hexBytes(t, test.item)
+		enc, err := rlp.EncodeToBytes(input)
+		if err != nil {
+			t.Fatalf("encoding failed: %v", err)
+		}
+
+		if err := rlp.DecodeBytes(enc, new(plainEverything)); err == nil {
+			t.Errorf("field %d = %s: reflective decoder accepted it", test.field, test.item)
+		}
+		checkDecode(t, everythingCase(test.item, nil), enc)
+	}
+}
+
+func hexBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+// TestDecodeMutations checks that the generated decoders accept and reject
+// the same inputs as the reflective decoder, by feeding both corrupted
+// encodings.
+func TestDecodeMutations(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, test := range testCases() {
+		enc, err := rlp.EncodeToBytes(test.plain())
+		if err != nil {
+			t.Fatalf("%s: encoding failed: %v", test.name, err)
+		}
+
+		for i := 0; i < 2000; i++ {
+			input := append([]byte(nil), enc...)
+			switch pos := rnd.Intn(len(input)); rnd.Intn(4) {
+			case 0:
+				input[pos] = byte(rnd.Intn(256))
+			case 1:
+				input[pos] ^= 1 << uint(rnd.Intn(8))
+			case 2:
+				input = append(input[:pos], input[pos+1:]...)
+			case 3:
+				input = append(input[:pos], append([]byte{byte(rnd.Intn(256))}, input[pos:]...)...)
+			}
+			if !checkDecode(t, test, input) {
+				break
+			}
+		}
+	}
+}
+
+// checkDecode decodes input with the generated and the reflective decoder,
+// and reports whether their results agree.
+func checkDecode(t *testing.T, test testCase, input []byte) bool {
+	t.Helper()
+
+	gen, plain := test.fresh()
+	genErr := rlp.DecodeBytes(input, gen)
+	plainErr := rlp.DecodeBytes(input, plain)
+	switch {
+	case (genErr == nil) != (plainErr == nil):
+		t.Errorf("%s: input %X\ngenerated error:  %v\nreflective error: %v", test.name, input, genErr, plainErr)
+		return false
+	case genErr != nil:
+		return true
+	}
+
+	// Compare the generated value as its plain type.
+	genPlain := reflect.ValueOf(gen).Convert(reflect.TypeOf(plain)).Interface()
+	if !reflect.DeepEqual(genPlain, plain) {
+		t.Errorf("%s: input %X\ngenerated  %+v\nreflective %+v", test.name, input, genPlain, plain)
+		return false
+	}
+	return true
+}
+
+func BenchmarkEncode(b *testing.B) {
+	v := fullEverything()
+	b.Run("generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := rlp.EncodeToBytes(v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("reflective", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := rlp.EncodeToBytes((*plainEverything)(v)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDecode(b *testing.B) {
+	enc, err := rlp.EncodeToBytes(fullEverything())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := rlp.DecodeBytes(enc, new(Everything)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("reflective", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := rlp.DecodeBytes(enc, new(plainEverything)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,120 @@
+// Package gentest holds types with generated RLP methods, which are tested
+// against the reflective codec.
+package gentest
+
+import (
+	"io"
+	"math/big"
+
+	"github.com/rawfalafel/ethereum-toolbox/rlp"
+	"github.com/rawfalafel/ethereum-toolbox/u256"
+)
+
+//go:generate go run ../.. -type Everything,Optional,Tree,Pointers -out gen_rlp.go
+
+type Nonce uint64
+
+type Flag bool
+
+type Data []byte
+
+type Inner struct {
+	A uint8
+	B string
+}
+
+// Coded encodes itself, so the generated code leaves it to the codec.
+type Coded struct {
+	N uint
+}
+
+func (c *Coded) EncodeRLP(w io.Writer) error {
+	if c == nil {
+		return rlp.Encode(w, []uint{0, 0})
+	}
+	return rlp.Encode(w, []uint{c.N, c.N})
+}
+
+func (c *Coded) DecodeRLP(s *rlp.Stream) error {
+	var ns []uint
+	if err := s.Decode(&ns); err != nil {
+		return err
+	}
+	if len(ns) != 2 || ns[0] != ns[1] {
+		return rlp.ErrExpectedList
+	}
+	c.N = ns[0]
+	return nil
+}
+
+// Everything has a field of every kind the generator knows.
+type Everything struct {
+	U8      uint8
+	U16     uint16
+	U32     uint32
+	U64     uint64
+	U       uint
+	B       byte
+	N       Nonce
+	Bool    bool
+	Flag    Flag
+	Str     string
+	Bytes   []byte
+	Data    Data
+	Hash    [32]byte
+	Short   [1]byte
+	Big     *big.Int
+	BigVal  big.Int
+	U256    u256.Uint256
+	U256Ptr *u256.Uint256
+	Raw     rlp.RawValue
+	Inner   Inner
+	InnerP  *Inner
+	NilP    *Inner   `rlp:"nil"`
+	NilBig  *big.Int `rlp:"nil"`
+	NilData *Data    `rlp:"nil"`
+	Nums    []uint32
+	Matrix  [][]string
+	Arr     [3]Inner
+	Hashes  [][4]byte
+	Coded   Coded
+	CodedP  *Coded
+	Any     interface{}
+	Anon    struct {
+		X uint16
+		Y []byte
+	}
+	Ignored uint `rlp:"-"`
+	private uint
+}
+
+// Optional has optional fields and a tail.
+type Optional struct {
+	A    uint64
+	B    uint64   `rlp:"optional"`
+	C    []byte   `rlp:"optional"`
+	D    *Inner   `rlp:"optional,nil"`
+	E    [2]byte  `rlp:"optional"`
+	Tail []string `rlp:"tail"`
+}
+
+// Tree refers to itself, which the generated code leaves to the codec.
+type Tree struct {
+	Val      uint
+	Children []*Tree
+	Next     *Tree `rlp:"nil"`
+}
+
+// Empty decodes from an empty list.
+type Empty struct {
+	A uint `rlp:"optional"`
+}
+
+// Pointers has pointers to pointers, whose nil values are the empty value
+// of the type at the end.
+type Pointers struct {
+	Struct    **Empty
+	Slice     **[]uint
+	Bytes     **[]byte
+	NilStruct **Inner `rlp:"nil"`
+}
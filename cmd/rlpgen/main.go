@@ -0,0 +1,55 @@
+// Command rlpgen generates EncodeRLP and DecodeRLP methods for struct
+// types, so that encoding and decoding them doesn't go through reflection.
+//
+// The generated methods follow the rules of package rlp, including the
+// "-", "nil", "tail" and "optional" struct tags, and produce the same
+// output as the reflective encoder. Fields whose types the generator can't
+// see through, such as types from other packages, are handed to the
+// reflective codec. Codecs added with rlp.Register are only used for such
+// fields, since the generated code handles the other types itself.
+//
+// Usage:
+//
+//	rlpgen -type Header,Body [-dir .] [-out gen_rlp.go]
+//
+// It's usually run from a go:generate directive:
+//
+//	//go:generate rlpgen -type Header -out gen_header_rlp.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	var (
+		typeNames = flag.String("type", "", "comma-separated list of struct types to generate methods for")
+		dir       = flag.String("dir", ".", "directory of the package declaring the types")
+		out       = flag.String("out", "", "output file, written to stdout if empty")
+	)
+	flag.Parse()
+
+	if *typeNames == "" {
+		fmt.Fprintln(os.Stderr, "rlpgen: -type is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	src, err := generate(*dir, strings.Split(*typeNames, ","), *out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rlpgen: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "rlpgen: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	rlpPath  = "github.com/rawfalafel/ethereum-toolbox/rlp"
+	u256Path = "github.com/rawfalafel/ethereum-toolbox/u256"
+)
+
+// typeKind says how a type is encoded. The kinds mirror the cases of the
+// reflective codec in package rlp.
+type typeKind int
+
+const (
+	kindUint typeKind = iota
+	kindBool
+	kindString
+	kindBytes
+	kindByteArray
+	kindBigInt
+	kindBigIntPtr
+	kindUint256
+	kindRaw
+	kindSlice
+	kindArray
+	kindPtr
+	kindStruct
+	// kindReflect is a type the generator can't see through, such as a type
+	// from another package or one with its own EncodeRLP method. Its values
+	// are handed to the reflective codec.
+	kindReflect
+)
+
+// rlpType is a resolved Go type.
+type rlpType struct {
+	kind typeKind
+	// name is the Go source of the type, e.g. "uint64" or "[]*Header".
+	name string
+	// basic is the underlying predeclared type of uints, bools and strings.
+	basic string
+	// pkgs holds the import names name refers to.
+	pkgs []string
+
+	elem   *rlpType   // slices, arrays and pointers
+	fields []rlpField // structs
+
+	// isPtr is set for all pointer types, including those of kindReflect
+	// and kindBigIntPtr.
+	isPtr bool
+	// nilKind is the empty value a nil pointer to this type stands for:
+	// "String" or "List", or "" if it can't be determined.
+	nilKind string
+	// maybeByte is set for types of kindReflect that are or may be bytes.
+	maybeByte bool
+}
+
+// rlpField is a struct field that is part of the RLP list.
+type rlpField struct {
+	name     string
+	typ      *rlpType
+	nilOK    bool
+	tail     bool
+	optional bool
+}
+
+// named returns a copy of t under another name.
+func (t *rlpType) named(name string) *rlpType {
+	cp := *t
+	cp.name, cp.pkgs = name, nil
+	return &cp
+}
+
+// pkgInfo is the parsed package the types are taken from.
+type pkgInfo struct {
+	fset  *token.FileSet
+	name  string
+	types map[string]*ast.TypeSpec
+	// files maps each type to the file declaring it, for resolving imports.
+	files map[string]*ast.File
+	// codecs holds the types that have an EncodeRLP or DecodeRLP method.
+	codecs map[string]bool
+}
+
+func newPkgInfo(fset *token.FileSet, pkg *ast.Package) *pkgInfo {
+	p := &pkgInfo{
+		fset:   fset,
+		name:   pkg.Name,
+		types:  make(map[string]*ast.TypeSpec),
+		files:  make(map[string]*ast.File),
+		codecs: make(map[string]bool),
+	}
+
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok {
+						p.types[ts.Name.Name] = ts
+						p.files[ts.Name.Name] = file
+					}
+				}
+			case *ast.FuncDecl:
+				if decl.Recv == nil || len(decl.Recv.List) == 0 {
+					continue
+				}
+				if name := decl.Name.Name; name == "EncodeRLP" || name == "DecodeRLP" {
+					if recv := receiverName(decl.Recv.List[0].Type); recv != "" {
+						p.codecs[recv] = true
+					}
+				}
+			}
+		}
+	}
+
+	return p
+}
+
+func receiverName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if id, ok := expr.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// importPath returns the path file imports under the given name.
+func importPath(file *ast.File, name string) string {
+	for _, imp := range file.Imports {
+		p, _ := strconv.Unquote(imp.Path.Value)
+		if imp.Name != nil && imp.Name.Name == name || imp.Name == nil && path.Base(p) == name {
+			return p
+		}
+	}
+	return ""
+}
+
+// resolver turns type expressions into rlpTypes.
+type resolver struct {
+	pkg *pkgInfo
+	// imports maps the import names seen in resolved types to their paths.
+	imports map[string]string
+	// resolving holds the named types being resolved, to break cycles.
+	resolving map[string]bool
+}
+
+func newResolver(pkg *pkgInfo) *resolver {
+	return &resolver{pkg: pkg, imports: make(map[string]string), resolving: make(map[string]bool)}
+}
+
+func (r *resolver) exprString(expr ast.Expr) string {
+	var buf bytes.Buffer
+	format.Node(&buf, r.pkg.fset, expr)
+	return buf.String()
+}
+
+// resolveRoot resolves the named struct type a generated codec is for.
+func (r *resolver) resolveRoot(name string) (*rlpType, error) {
+	spec, ok := r.pkg.types[name]
+	if !ok {
+		return nil, fmt.Errorf("type %s not found in package %s", name, r.pkg.name)
+	}
+	if _, ok := spec.Type.(*ast.StructType); !ok {
+		return nil, fmt.Errorf("type %s is not a struct", name)
+	}
+	if r.pkg.codecs[name] {
+		return nil, fmt.Errorf("type %s already has an EncodeRLP or DecodeRLP method", name)
+	}
+
+	r.resolving[name] = true
+	defer delete(r.resolving, name)
+
+	t, err := r.resolve(spec.Type, r.pkg.files[name])
+	if err != nil {
+		return nil, err
+	}
+	return t.named(name), nil
+}
+
+func (r *resolver) resolve(expr ast.Expr, file *ast.File) (*rlpType, error) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return r.resolve(e.X, file)
+	case *ast.Ident:
+		return r.resolveIdent(e.Name)
+	case *ast.SelectorExpr:
+		return r.resolveSelector(e, file)
+	case *ast.StarExpr:
+		return r.resolvePtr(e, file)
+	case *ast.ArrayType:
+		return r.resolveArray(e, file)
+	case *ast.StructType:
+		return r.resolveStruct(e, file)
+	case *ast.InterfaceType:
+		return &rlpType{kind: kindReflect, name: r.exprString(e), nilKind: "List"}, nil
+	}
+
+	return nil, fmt.Errorf("type %s is not RLP-serializable", r.exprString(expr))
+}
+
+func (r *resolver) resolveIdent(name string) (*rlpType, error) {
+	switch name {
+	case "uint8", "byte":
+		return &rlpType{kind: kindUint, name: name, basic: "uint8", nilKind: "String"}, nil
+	case "uint16", "uint32", "uint64", "uint":
+		return &rlpType{kind: kindUint, name: name, basic: name, nilKind: "String"}, nil
+	case "bool":
+		return &rlpType{kind: kindBool, name: name, basic: name, nilKind: "String"}, nil
+	case "string":
+		return &rlpType{kind: kindString, name: name, basic: name, nilKind: "String"}, nil
+	case "any":
+		return &rlpType{kind: kindReflect, name: name, nilKind: "List"}, nil
+	}
+
+	spec, ok := r.pkg.types[name]
+	if !ok {
+		return nil, fmt.Errorf("type %s is not RLP-serializable", name)
+	}
+
+	if r.pkg.codecs[name] || r.resolving[name] {
+		file := r.pkg.files[name]
+		return &rlpType{kind: kindReflect, name: name, nilKind: r.nilKindOf(spec.Type, file, 0), maybeByte: r.isUint8(spec.Type, 0)}, nil
+	}
+
+	r.resolving[name] = true
+	defer delete(r.resolving, name)
+
+	t, err := r.resolve(spec.Type, r.pkg.files[name])
+	if err != nil {
+		return nil, err
+	}
+	if spec.Assign.IsValid() {
+		// An alias is the very same type.
+		return t.named(name), nil
+	}
+
+	switch t.kind {
+	case kindBigInt, kindUint256:
+		// The codec recognizes these types only by identity, so a type
+		// defined on top of them is a plain struct or array.
+		return &rlpType{kind: kindReflect, name: name, nilKind: "List"}, nil
+	case kindBigIntPtr:
+		return &rlpType{kind: kindReflect, name: name, elem: t.elem, isPtr: true, nilKind: "String"}, nil
+	case kindRaw:
+		t = &rlpType{kind: kindBytes, nilKind: "String"}
+	}
+	return t.named(name), nil
+}
+
+func (r *resolver) resolveSelector(e *ast.SelectorExpr, file *ast.File) (*rlpType, error) {
+	pkg, ok := e.X.(*ast.Ident)
+	if !ok {
+		return nil, fmt.Errorf("type %s is not RLP-serializable", r.exprString(e))
+	}
+
+	p := importPath(file, pkg.Name)
+	if p == "" {
+		return nil, fmt.Errorf("package %s of type %s is not imported", pkg.Name, r.exprString(e))
+	}
+	r.imports[pkg.Name] = p
+
+	t := &rlpType{kind: kindReflect, name: pkg.Name + "." + e.Sel.Name, pkgs: []string{pkg.Name}, maybeByte: true}
+	switch {
+	case p == "math/big" && e.Sel.Name == "Int":
+		t.kind, t.nilKind, t.maybeByte = kindBigInt, "String", false
+	case p == u256Path && e.Sel.Name == "Uint256":
+		t.kind, t.nilKind, t.maybeByte = kindUint256, "String", false
+	case p == rlpPath && e.Sel.Name == "RawValue":
+		t.kind, t.nilKind, t.maybeByte = kindRaw, "String", false
+	}
+	return t, nil
+}
+
+func (r *resolver) resolvePtr(e *ast.StarExpr, file *ast.File) (*rlpType, error) {
+	elem, err := r.resolve(e.X, file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like a nil pointer, a pointer to one stands for the empty value of
+	// the type at the end of the chain.
+	t := &rlpType{kind: kindPtr, name: "*" + elem.name, pkgs: elem.pkgs, elem: elem, isPtr: true, nilKind: elem.nilKind}
+	switch elem.kind {
+	case kindBigInt:
+		t.kind = kindBigIntPtr
+	case kindReflect:
+		// The element may implement Encoder, which is called even for
+		// nil pointers, so the pointer goes to the codec as a whole.
+		t.kind = kindReflect
+	}
+	return t, nil
+}
+
+func (r *resolver) resolveArray(e *ast.ArrayType, file *ast.File) (*rlpType, error) {
+	elem, err := r.resolve(e.Elt, file)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &rlpType{elem: elem, pkgs: elem.pkgs, nilKind: "List"}
+	if e.Len == nil {
+		t.kind, t.name = kindSlice, "[]"+elem.name
+	} else {
+		if _, ok := e.Len.(*ast.Ellipsis); ok {
+			return nil, fmt.Errorf("array type %s has no length", r.exprString(e))
+		}
+		t.kind, t.name = kindArray, "["+r.exprString(e.Len)+"]"+elem.name
+		if sel, ok := e.Len.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				r.imports[id.Name] = importPath(file, id.Name)
+				t.pkgs = append([]string{id.Name}, t.pkgs...)
+			}
+		}
+	}
+
+	switch {
+	case elem.kind == kindUint && elem.basic == "uint8" && (elem.name == "byte" || elem.name == "uint8"):
+		t.nilKind = "String"
+		if t.kind == kindSlice {
+			t.kind, t.name = kindBytes, "[]byte"
+		} else {
+			t.kind = kindByteArray
+		}
+	case elem.kind == kindUint && elem.basic == "uint8", elem.maybeByte:
+		// Elements of a named byte type, or of a type that might be one,
+		// make this a string, which is left to the codec.
+		t.kind, t.nilKind = kindReflect, r.nilKindOf(e, file, 0)
+	}
+	return t, nil
+}
+
+func (r *resolver) resolveStruct(e *ast.StructType, file *ast.File) (*rlpType, error) {
+	t := &rlpType{kind: kindStruct, name: r.exprString(e), nilKind: "List"}
+	for i, f := range e.Fields.List {
+		names := make([]string, 0, len(f.Names))
+		for _, id := range f.Names {
+			names = append(names, id.Name)
+		}
+		if len(names) == 0 {
+			// An embedded field is named after its type.
+			names = append(names, embeddedName(f.Type))
+		}
+
+		var tag string
+		if f.Tag != nil {
+			tag, _ = strconv.Unquote(f.Tag.Value)
+		}
+
+		for j, name := range names {
+			last := i == len(e.Fields.List)-1 && j == len(names)-1
+			ft, err := r.resolveField(t, name, f.Type, tag, last, file)
+			if err != nil {
+				return nil, err
+			}
+			if ft != nil {
+				t.fields = append(t.fields, *ft)
+			}
+		}
+	}
+
+	return t, nil
+}
+
+func embeddedName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// resolveField returns the field of struct st, or nil if it's not encoded.
+// The tag rules are those of the reflective codec.
+func (r *resolver) resolveField(st *rlpType, name string, expr ast.Expr, tag string, last bool, file *ast.File) (*rlpField, error) {
+	f := &rlpField{name: name}
+	var ignored bool
+	for _, t := range strings.Split(reflect.StructTag(tag).Get("rlp"), ",") {
+		switch t = strings.TrimSpace(t); t {
+		case "":
+		case "-":
+			ignored = true
+		case "optional":
+			f.optional = true
+		case "nil":
+			f.nilOK = true
+		case "tail":
+			f.tail = true
+			if !last {
+				return nil, fmt.Errorf(`invalid struct tag "tail" for %s (must be on last field)`, name)
+			}
+		default:
+			return nil, fmt.Errorf("unknown struct tag %q on %s", t, name)
+		}
+	}
+
+	if ignored || !ast.IsExported(name) {
+		return nil, nil
+	}
+
+	if n := len(st.fields); n > 0 && st.fields[n-1].optional && !f.optional && !f.tail {
+		return nil, fmt.Errorf(`struct field %s needs "optional" tag because it follows optional field %s`, name, st.fields[n-1].name)
+	}
+
+	var err error
+	if f.typ, err = r.resolve(expr, file); err != nil {
+		return nil, fmt.Errorf("field %s: %v", name, err)
+	}
+
+	switch {
+	case f.nilOK && !f.typ.isPtr:
+		return nil, fmt.Errorf(`invalid struct tag "nil" for %s (field is not a pointer)`, name)
+	case f.nilOK && f.typ.elem != nil && f.typ.elem.nilKind == "":
+		return nil, fmt.Errorf(`struct tag "nil" for %s: can't tell whether %s is a string or a list`, name, f.typ.elem.name)
+	case f.tail && f.typ.kind != kindSlice:
+		return nil, fmt.Errorf(`invalid struct tag "tail" for %s (field type is not slice)`, name)
+	}
+
+	return f, nil
+}
+
+// nilKindOf works out the empty value of a type from its declaration alone.
+// It's used for types that are otherwise left to the reflective codec.
+func (r *resolver) nilKindOf(expr ast.Expr, file *ast.File, depth int) string {
+	if depth > 16 {
+		return ""
+	}
+
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return r.nilKindOf(e.X, file, depth+1)
+	case *ast.StructType, *ast.InterfaceType:
+		return "List"
+	case *ast.StarExpr:
+		return r.nilKindOf(e.X, file, depth+1)
+	case *ast.ArrayType:
+		if r.isUint8(e.Elt, depth+1) {
+			return "String"
+		}
+		if sel, ok := e.Elt.(*ast.SelectorExpr); ok && !r.isKnownSelector(sel, file) {
+			// A type from another package may be a byte.
+			return ""
+		}
+		return "List"
+	case *ast.SelectorExpr:
+		if r.isKnownSelector(e, file) {
+			return "String"
+		}
+		return ""
+	case *ast.Ident:
+		if spec, ok := r.pkg.types[e.Name]; ok {
+			return r.nilKindOf(spec.Type, r.pkg.files[e.Name], depth+1)
+		}
+		if e.Name == "any" {
+			return "List"
+		}
+		return "String"
+	}
+	return ""
+}
+
+// isKnownSelector reports whether sel is one of the types from other
+// packages that the codec handles itself.
+func (r *resolver) isKnownSelector(sel *ast.SelectorExpr, file *ast.File) bool {
+	id, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+
+	switch p := importPath(file, id.Name); {
+	case p == "math/big" && sel.Sel.Name == "Int",
+		p == u256Path && sel.Sel.Name == "Uint256",
+		p == rlpPath && sel.Sel.Name == "RawValue":
+		return true
+	}
+	return false
+}
+
+func (r *resolver) isUint8(expr ast.Expr, depth int) bool {
+	id, ok := expr.(*ast.Ident)
+	if !ok || depth > 16 {
+		return false
+	}
+	if id.Name == "byte" || id.Name == "uint8" {
+		return true
+	}
+	if spec, ok := r.pkg.types[id.Name]; ok {
+		return r.isUint8(spec.Type, depth+1)
+	}
+	return false
+}
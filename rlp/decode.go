@@ -1,25 +1,201 @@
 package rlp
 
 import (
+	"bytes"
 	"math/big"
+	"math/bits"
 	"io"
 	"fmt"
 	"reflect"
-)
+	"sync"
+	"unsafe"
 
+	"github.com/rawfalafel/ethereum-toolbox/u256"
+)
 
-// Decode ...
-// Assumes that the val is an empty pointer generated by new(Type)
+// readChunk caps how much memory is reserved for an item before its payload
+// has actually been read. Larger items grow as data arrives, so a bogus size
+// in the header can't force a huge allocation.
+const readChunk = 4096
+
+// Decode reads exactly one RLP item from r and decodes it into val, using the
+// same decoders as DecodeBytes. Nothing past the end of the item is consumed,
+// so successive calls decode successive items.
+//
+// Decode returns io.EOF if r is empty and io.ErrUnexpectedEOF if r ends in
+// the middle of an item.
 func Decode(r io.Reader, val interface{}) error {
-	return nil
+	return defaultDecodeOptions.Decode(r, val)
+}
+
+// readItem reads the header of the next item from r, followed by its payload,
+// and returns the complete encoding.
+func readItem(r io.Reader, maxSize int) ([]byte, error) {
+	var header [9]byte
+	if _, err := io.ReadFull(r, header[:1]); err != nil {
+		return nil, err
+	}
+
+	var headerSiz int
+	var siz uint64
+	switch b := header[0]; {
+	case b < 0x80:
+		return header[:1], nil
+	case b < 0xb8:
+		siz = uint64(b - 0x80)
+	case b < 0xc0:
+		headerSiz = int(b - 0xb7)
+	case b < 0xf8:
+		siz = uint64(b - 0xc0)
+	default:
+		headerSiz = int(b - 0xf7)
+	}
+
+	if headerSiz > 0 {
+		if _, err := io.ReadFull(r, header[1:1+headerSiz]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		siz = decodeBigEndian(header[1 : 1+headerSiz])
+	}
+
+	// The limit is checked first, and without overflowing, so that it's
+	// what an absurd size runs into when one is set.
+	if maxSize > 0 && (siz >= uint64(maxSize) || uint64(1+headerSiz)+siz > uint64(maxSize)) {
+		return nil, &DecodeError{Err: ErrInputTooLarge}
+	}
+	if siz > uint64(maxInt-1-headerSiz) {
+		return nil, &DecodeError{Err: ErrSizeOverflow}
+	}
+
+	prealloc := siz
+	if prealloc > readChunk {
+		prealloc = readChunk
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, 1+headerSiz+int(prealloc)))
+	out.Write(header[:1+headerSiz])
+	if _, err := io.CopyN(out, r, int64(siz)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return out.Bytes(), nil
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
 }
 
-// DecodeBytes ...
+// DecodeBytes decodes data, which must hold exactly one RLP item, into the
+// value v points to.
+//
+// Existing values are decoded into rather than replaced, so that decoding
+// into the same value over and over doesn't allocate every time: non-nil
+// pointers keep pointing to the same object, and slices, including byte
+// slices, reuse their backing arrays when they're large enough. Don't decode
+// into values sharing memory with anything that is still in use.
 func DecodeBytes(data []byte, v interface{}) error {
-	b := newBuffer(data)
+	return defaultDecodeOptions.DecodeBytes(data, v)
+}
+
+// DecodeOptions controls how input is validated while decoding. The zero
+// value is what Decode and DecodeBytes use.
+type DecodeOptions struct {
+	// Lenient accepts input that isn't minimally encoded: single bytes
+	// wrapped in a string header, long-form headers for short payloads,
+	// and sizes or integers with leading zero bytes. It's meant for
+	// inspecting data produced by broken encoders. Untrusted input should
+	// always be decoded strictly.
+	Lenient bool
+
+	// The limits below guard against input crafted to exhaust memory or
+	// stack. Zero means no limit. Exceeding a limit fails decoding with
+	// ErrInputTooLarge, ErrTooDeep, ErrListTooLong or ErrBigIntTooLarge.
+
+	// MaxInputSize is the largest input, in bytes, that will be decoded.
+	// Decode checks it against the item header before reading the payload.
+	MaxInputSize int
+	// MaxDepth is the deepest nesting of lists that will be decoded.
+	MaxDepth int
+	// MaxListElems is the largest number of elements a decoded list may
+	// have.
+	MaxListElems int
+	// MaxBigIntBits is the largest bit length a decoded big.Int may have.
+	MaxBigIntBits int
+
+	// AliasInput lets decoded []byte, RawValue and string values, and
+	// the results of Stream.Bytes and Stream.Raw, share memory with the
+	// input instead of copying it. That saves an allocation per value,
+	// but the input must not be modified or reused while they are in use.
+	// By default everything is copied.
+	//
+	// Decode and streams reading from an io.Reader always alias, since
+	// the input they read into isn't shared with anyone.
+	AliasInput bool
+}
+
+var defaultDecodeOptions = &DecodeOptions{}
+
+// Decode decodes one item from r like the package-level Decode, validating
+// the input according to opts.
+func (opts *DecodeOptions) Decode(r io.Reader, val interface{}) error {
+	dat, err := readItem(r, opts.MaxInputSize)
+	if err != nil {
+		return err
+	}
+
+	b := newBuffer(dat, opts)
+	b.alias = true
+	return b.decodeInput(val)
+}
+
+// DecodeBytes decodes data like the package-level DecodeBytes, validating
+// the input according to opts.
+func (opts *DecodeOptions) DecodeBytes(data []byte, v interface{}) error {
+	if opts.MaxInputSize > 0 && len(data) > opts.MaxInputSize {
+		return &DecodeError{Err: ErrInputTooLarge}
+	}
+
+	return newBuffer(data, opts).decodeInput(v)
+}
 
+// decodeInput decodes buf, which must hold exactly one item, into the
+// value v points to.
+func (buf *buffer) decodeInput(v interface{}) error {
+	if err := buf.decodeValue(v); err != nil {
+		if de, ok := err.(*DecodeError); ok {
+			de.Path = typeName(reflect.TypeOf(v)) + de.Path
+		}
+		return err
+	}
+
+	if buf.idx != len(buf.dat) {
+		return &DecodeError{Err: ErrMoreThanOneValue, Offset: buf.idx}
+	}
+
+	return nil
+}
+
+// typeName returns the name of the type behind any number of pointers. It's
+// the first element of the path in a DecodeError.
+func typeName(typ reflect.Type) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	return typ.Name()
+}
+
+// decodeValue decodes the next item in buf into the value v points to.
+func (buf *buffer) decodeValue(v interface{}) error {
 	val := reflect.ValueOf(v)
-	if val.IsNil() {
+	if val.Kind() != reflect.Ptr || val.IsNil() {
 		return fmt.Errorf("can not decode to a non-pointer")
 	}
 
@@ -30,57 +206,163 @@ func DecodeBytes(data []byte, v interface{}) error {
 		return err
 	}
 
-	if err := dec(b, val1); err != nil {
-		return err
-	}
-
-	if b.idx != len(b.dat) {
-		return fmt.Errorf("did not parse entire buffer. idx: %d, length: %d", b.idx, len(b.dat))
+	off := buf.offset()
+	if err := dec(buf, val1); err != nil {
+		return wrapError(err, off, "")
 	}
 
 	return nil
 }
 
-func newBuffer(data []byte) *buffer {
-	return &buffer{dat: data}
+func newBuffer(data []byte, opts *DecodeOptions) *buffer {
+	return &buffer{dat: data, opts: opts, alias: opts.AliasInput}
 }
 
 type buffer struct {
-	dat []byte
-	idx int // offset
+	dat  []byte
+	idx  int // offset
+	opts *DecodeOptions
+	// base is the offset of dat within the complete input.
+	base int
+	// depth is the number of lists enclosing dat.
+	depth int
+	// alias is set if decoded values may share memory with dat.
+	alias bool
+}
+
+// sub returns a buffer over data, which must be the payload of the item
+// just read from buf.
+func (buf *buffer) sub(data []byte) *buffer {
+	b := newBuffer(data, buf.opts)
+	b.base = buf.base + buf.idx - len(data)
+	b.depth = buf.depth + 1
+	b.alias = buf.alias
+	return b
+}
+
+// result returns b for use in a decoded value: b itself if buf aliases its
+// input, a copy otherwise.
+func (buf *buffer) result(b []byte) []byte {
+	if buf.alias {
+		return b
+	}
+
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
+// resultInto is like result, but copies into dst if it's large enough.
+func (buf *buffer) resultInto(dst, b []byte) []byte {
+	if buf.alias || cap(dst) < len(b) || dst == nil {
+		return buf.result(b)
+	}
+
+	return append(dst[:0], b...)
+}
+
+// offset returns the position of the next item within the complete input.
+func (buf *buffer) offset() int {
+	return buf.base + buf.idx
+}
+
+// errEnd is returned when an item is expected but buf has none left.
+func (buf *buffer) errEnd() error {
+	if buf.depth > 0 {
+		return ErrTooFewElements
+	}
+
+	return io.EOF
+}
+
+// checkListLen fails once a list has more than the allowed number of
+// elements.
+func (buf *buffer) checkListLen(n int) error {
+	if max := buf.opts.MaxListElems; max > 0 && n > max {
+		return ErrListTooLong
+	}
+
+	return nil
+}
+
+// errTruncated is returned when an item extends past the end of buf.
+func (buf *buffer) errTruncated() error {
+	if buf.depth > 0 {
+		return ErrElemTooLarge
+	}
+
+	return io.ErrUnexpectedEOF
 }
 
 type decoder func(*buffer, reflect.Value) error
 
-var decoderCache = map[reflect.Type]decoder{}
+var (
+	decoderMu    sync.RWMutex
+	decoderCache = map[reflect.Type]*typeDecoder{}
+)
+
+// typeDecoder is the cache entry for a type. It's added to the cache before
+// the decoder is built, so that a recursive type can find itself while it's
+// still being built.
+type typeDecoder struct {
+	dec decoder
+	err error
+}
 
 func getDecoder(typ reflect.Type) (decoder, error) {
-	var err error
-	dec, ok := decoderCache[typ]
+	decoderMu.RLock()
+	td, ok := decoderCache[typ]
+	decoderMu.RUnlock()
 
 	if ok {
-		return dec, nil
+		return td.dec, td.err
 	}
 
-	dummyDec := new(decoder)
-	decoderCache[typ] = *dummyDec
+	decoderMu.Lock()
+	defer decoderMu.Unlock()
+	return getDecoderLocked(typ)
+}
 
-	if dec, err = getDecoder1(typ); err != nil {
-		delete(decoderCache, typ)
-		return nil, err
+// getDecoderLocked is getDecoder for callers holding decoderMu, which are
+// the functions that build decoders.
+func getDecoderLocked(typ reflect.Type) (decoder, error) {
+	if td, ok := decoderCache[typ]; ok {
+		if td.dec == nil && td.err == nil {
+			// typ refers to itself and is still being built further
+			// up the stack. Look the decoder up when it's needed,
+			// by which time it's complete.
+			return func(buf *buffer, val reflect.Value) error {
+				if td.err != nil {
+					return td.err
+				}
+				return td.dec(buf, val)
+			}, nil
+		}
+
+		return td.dec, td.err
 	}
 
-	decoderCache[typ] = dec
-	return dec, nil
+	td := new(typeDecoder)
+	decoderCache[typ] = td
+	td.dec, td.err = getDecoder1(typ)
+	return td.dec, td.err
 }
 
 func getDecoder1(typ reflect.Type) (decoder, error) {
 	kind := typ.Kind()
 	switch {
+	case decodeFuncs[typ] != nil:
+		return makeRegisteredDecoder(decodeFuncs[typ]), nil
+	case typ == rawValueType:
+		return (*buffer).decodeRawValue, nil
+	case reflect.PtrTo(typ).Implements(decoderInterface):
+		return decodeDecoder, nil
 	case typ.AssignableTo(bigIntPtr):
 		return (*buffer).decodeBigIntPtr, nil
 	case typ.AssignableTo(bigInt):
 		return (*buffer).decodeBigInt, nil
+	case typ == uint256Type:
+		return (*buffer).decodeUint256, nil
 	case isUint(kind):
 		return (*buffer).decodeUint, nil
 	case kind == reflect.Bool:
@@ -92,23 +374,127 @@ func getDecoder1(typ reflect.Type) (decoder, error) {
 	case isByteSlice(typ, kind):
 		return (*buffer).decodeByteSlice, nil
 	case kind == reflect.Slice || kind == reflect.Array:
-		return (*buffer).decodeList, nil
+		return makeListDecoder(typ)
 	case kind == reflect.Struct:
 		return makeStructDecoder(typ)
 	case kind == reflect.Ptr:
 		return makeDecodePtr(typ)
-	case kind == reflect.Interface:
+	case kind == reflect.Interface && typ.NumMethod() == 0:
+		return (*buffer).decodeInterface, nil
 	}
 
 	return nil, fmt.Errorf("decoder does not support type: %v", typ)
 }
 
 func isByteArray(typ reflect.Type, kind reflect.Kind) bool {
-	return kind == reflect.Array && typ.Elem().Kind() == reflect.Uint8
+	return kind == reflect.Array && isDecodableByte(typ.Elem())
 }
 
 func isByteSlice(typ reflect.Type, kind reflect.Kind) bool {
-	return kind == reflect.Slice && typ.Elem().Kind() == reflect.Uint8
+	return kind == reflect.Slice && isDecodableByte(typ.Elem())
+}
+
+// isDecodableByte is the decoding counterpart of isByte. It must be called
+// with decoderMu held.
+func isDecodableByte(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Uint8 && !reflect.PtrTo(typ).Implements(decoderInterface) && decodeFuncs[typ] == nil
+}
+
+// Decoder is implemented by types that decode themselves. DecodeRLP receives
+// a Stream holding exactly one item, and must consume all of it. Both value
+// and pointer receivers are supported.
+type Decoder interface {
+	DecodeRLP(*Stream) error
+}
+
+var decoderInterface = reflect.TypeOf(new(Decoder)).Elem()
+
+func decodeDecoder(buf *buffer, val reflect.Value) error {
+	if !val.CanAddr() {
+		return fmt.Errorf("rlp: unaddressable value of type %v, DecodeRLP needs a pointer", val.Type())
+	}
+
+	s, err := buf.itemStream()
+	if err != nil {
+		return err
+	}
+
+	if err := val.Addr().Interface().(Decoder).DecodeRLP(s); err != nil {
+		return err
+	}
+
+	if !s.consumed() {
+		return &DecodeError{Err: ErrNotConsumed, Offset: s.buf.offset()}
+	}
+
+	return nil
+}
+
+// itemStream consumes the next item and returns a Stream holding just that
+// item, to be handed to code decoding it by hand.
+func (buf *buffer) itemStream() (*Stream, error) {
+	raw, err := buf.getRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	// raw is a complete item rather than a list payload, so it sits at
+	// the same depth as buf.
+	top := buf.sub(raw)
+	top.depth = buf.depth
+	return &Stream{buf: top, opts: buf.opts}, nil
+}
+
+// decodeInterface decodes into an empty interface. Lists become []interface{}
+// and strings become []byte, which is the shape interfaceWriter produces.
+func (buf *buffer) decodeInterface(val reflect.Value) error {
+	item, err := buf.decodeGeneric()
+	if err != nil {
+		return err
+	}
+
+	val.Set(reflect.ValueOf(item))
+	return nil
+}
+
+func (buf *buffer) decodeGeneric() (interface{}, error) {
+	dat := buf.getCurrentSlice()
+	if len(dat) == 0 {
+		return nil, buf.errEnd()
+	}
+
+	if dat[0] < 0xc0 {
+		b, err := buf.getBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		return buf.result(b), nil
+	}
+
+	listDat, err := buf.getList()
+	if err != nil {
+		return nil, err
+	}
+
+	listBuf := buf.sub(listDat)
+
+	items := []interface{}{}
+	for listBuf.idx < len(listBuf.dat) {
+		if err := listBuf.checkListLen(len(items) + 1); err != nil {
+			return nil, err
+		}
+
+		off := listBuf.offset()
+		item, err := listBuf.decodeGeneric()
+		if err != nil {
+			return nil, wrapError(err, off, indexPath(len(items)))
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
 }
 
 func (buf *buffer) decodeByteArray(val reflect.Value) error {
@@ -117,14 +503,12 @@ func (buf *buffer) decodeByteArray(val reflect.Value) error {
 		return err
 	}
 
-	vlen := val.Len()
-	dlen := len(dat)
-	if vlen > dlen {
-		return fmt.Errorf("byte array too short")
-	} else if vlen < dlen {
-		return fmt.Errorf("byte array too long")
+	if val.Len() != len(dat) {
+		return ErrByteArrayLength
 	}
 
+	vlen := val.Len()
+
 	for i := 0; i < vlen; i++ {
 		val.Index(i).SetUint(uint64(dat[i]))
 	}
@@ -132,13 +516,23 @@ func (buf *buffer) decodeByteArray(val reflect.Value) error {
 	return nil
 }
 
+func (buf *buffer) decodeRawValue(val reflect.Value) error {
+	raw, err := buf.getRaw()
+	if err != nil {
+		return err
+	}
+
+	val.SetBytes(buf.resultInto(val.Bytes(), raw))
+	return nil
+}
+
 func (buf *buffer) decodeByteSlice(val reflect.Value) error {
 	dat, err := buf.getBytes()
 	if err != nil {
 		return err
 	}
 
-	val.SetBytes(dat)
+	val.SetBytes(buf.resultInto(val.Bytes(), dat))
 	return nil
 }
 
@@ -147,15 +541,11 @@ func (buf *buffer) decodeBigInt(val reflect.Value) error {
 }
 
 func (buf *buffer) decodeBigIntPtr(val reflect.Value) error {
-	dat, err := buf.getBytes()
+	dat, err := buf.getBigIntBytes()
 	if err != nil {
 		return err
 	}
 
-	if len(dat) > 0 && dat[0] == 0 {
-		return fmt.Errorf("strings cannot have leading zeros")
-	}
-
 	i := val.Interface().(*big.Int)
 	if i == nil {
 		i = new(big.Int)
@@ -167,46 +557,115 @@ func (buf *buffer) decodeBigIntPtr(val reflect.Value) error {
 	return nil
 }
 
-func (buf *buffer) decodeBool(val reflect.Value) error {
+func (buf *buffer) decodeUint256(val reflect.Value) error {
+	return buf.getUint256(val.Addr().Interface().(*u256.Uint256))
+}
+
+func (buf *buffer) getUint256(z *u256.Uint256) error {
 	dat, err := buf.getBytes()
 	if err != nil {
 		return err
 	}
 
-	if len(dat) != 1 {
-		return fmt.Errorf("error parsing bool. item length (%d) too long", len(dat))
+	if len(dat) > 0 && dat[0] == 0 {
+		if !buf.opts.Lenient {
+			return ErrCanonInt
+		}
+
+		dat = bytes.TrimLeft(dat, "\x00")
+	}
+
+	if len(dat) > 32 {
+		return ErrValueTooLarge
 	}
 
-	if dat[0] == 0x01 {
-		val.SetBool(true)
-	} else if dat[0] == 0x80 {
-		val.SetBool(false)
-	} else {
-		return fmt.Errorf("error parsing bool. byte code invalid: %x", dat[0])
+	z.SetBytes(dat)
+	return nil
+}
+
+func (buf *buffer) decodeBool(val reflect.Value) error {
+	b, err := buf.getBool()
+	if err != nil {
+		return err
 	}
 
+	val.SetBool(b)
 	return nil
 }
 
-func (buf *buffer) decodeUint(val reflect.Value) error {
+func (buf *buffer) getBool() (bool, error) {
 	dat, err := buf.getBytes()
+	if err != nil {
+		return false, err
+	}
+
+	if len(dat) == 0 {
+		return false, nil
+	} else if len(dat) == 1 && dat[0] == 0x01 {
+		return true, nil
+	}
+
+	return false, ErrInvalidBool
+}
+
+// getBigIntBytes returns the big-endian bytes of the next integer, checked
+// against the canonical form and MaxBigIntBits.
+func (buf *buffer) getBigIntBytes() ([]byte, error) {
+	dat, err := buf.getBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dat) > 0 && dat[0] == 0 && !buf.opts.Lenient {
+		return nil, ErrCanonInt
+	}
+
+	if max := buf.opts.MaxBigIntBits; max > 0 {
+		trimmed := bytes.TrimLeft(dat, "\x00")
+		if len(trimmed) > 0 && (len(trimmed)-1)*8+bits.Len8(trimmed[0]) > max {
+			return nil, ErrBigIntTooLarge
+		}
+	}
+
+	return dat, nil
+}
+
+func (buf *buffer) decodeUint(val reflect.Value) error {
+	num, err := buf.getUint()
 	if err != nil {
 		return err
 	}
 
-	// TODO: This needs to be a uint
-	siz := len(dat)
-	if siz == 0 {
-		return fmt.Errorf("error parsing uint. no bytes to parse")
-	} else if siz == 1 {
-		val.SetUint(uint64(dat[0]))
-		return nil
+	if val.OverflowUint(num) {
+		return ErrValueTooLarge
 	}
 
-	val.SetUint(decodeBigEndian(dat))
+	val.SetUint(num)
 	return nil
 }
 
+// getUint reads the next integer, which must fit in 64 bits.
+func (buf *buffer) getUint() (uint64, error) {
+	dat, err := buf.getBytes()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(dat) > 0 && dat[0] == 0 {
+		if !buf.opts.Lenient {
+			return 0, ErrCanonInt
+		}
+
+		dat = bytes.TrimLeft(dat, "\x00")
+	}
+
+	if len(dat) > 8 {
+		return 0, ErrValueTooLarge
+	}
+
+	return decodeBigEndian(dat), nil
+}
+
 func decodeBigEndian(dat []byte) uint64 {
 	var out uint64
 
@@ -221,97 +680,134 @@ func decodeBigEndian(dat []byte) uint64 {
 
 func makeDecodePtr(typ reflect.Type) (decoder, error) {
 	t1 := typ.Elem()
-	dec, err := getDecoder(t1)
+	dec, err := getDecoderLocked(t1)
 	if err != nil {
 		return nil, err
 	}
 
 	return func(buf *buffer, val reflect.Value) error {
-		val.Set(reflect.New(t1))
-		if err := dec(buf, val.Elem()); err != nil {
-			return err
+		if val.IsNil() {
+			val.Set(reflect.New(t1))
 		}
 
-		return nil
+		return dec(buf, val.Elem())
 	} , nil
 }
 
-func (buf *buffer) decodeList(val reflect.Value) error {
-	listDat, err := buf.getList()
+// makeListDecoder returns a decoder for a slice or array, which decodes the
+// list in a single pass over its elements. Slices grow as elements arrive;
+// arrays must get exactly as many elements as they hold.
+func makeListDecoder(typ reflect.Type) (decoder, error) {
+	dec, err := getDecoderLocked(typ.Elem())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	listBuf := newBuffer(listDat)
+	if typ.Kind() == reflect.Array {
+		return func(buf *buffer, val reflect.Value) error {
+			listDat, err := buf.getList()
+			if err != nil {
+				return err
+			}
 
-	typ1 := val.Type().Elem()
-	dec, err := getDecoder(typ1)
-	if err != nil {
-		return err
+			return buf.sub(listDat).decodeArrayElems(val, dec)
+		}, nil
 	}
 
-	sliceLen, err := listBuf.seekNumItems()
-	if err != nil {
-		return err
-	}
+	return func(buf *buffer, val reflect.Value) error {
+		listDat, err := buf.getList()
+		if err != nil {
+			return err
+		}
+
+		return buf.sub(listDat).decodeSliceElems(val, dec)
+	}, nil
+}
 
-	if val.Type().Kind() == reflect.Slice {
-		val.Set(reflect.MakeSlice(val.Type(), sliceLen, sliceLen))
-	} else if val.Type().Kind() == reflect.Array && val.Len() != sliceLen {
-		return fmt.Errorf("number of items (%d) does not match array size (%d", sliceLen, val.Len())
+// decodeSliceElems decodes the remaining elements of buf into the slice val.
+// Elements already in val, or in its spare capacity, are decoded into.
+func (buf *buffer) decodeSliceElems(val reflect.Value, dec decoder) error {
+	if val.IsNil() {
+		val.Set(reflect.MakeSlice(val.Type(), 0, 0))
 	}
 
-	for i := 0; i < sliceLen; i++ {
-		if err := dec(listBuf, val.Index(i)); err != nil {
-			return fmt.Errorf("decoder failed for list index %d: %v", i, err)
+	i := 0
+	for ; buf.idx < len(buf.dat); i++ {
+		if err := buf.checkListLen(i + 1); err != nil {
+			return err
+		}
+
+		if i == val.Cap() {
+			growSlice(val)
+		}
+		if i >= val.Len() {
+			val.SetLen(i + 1)
+		}
+
+		off := buf.offset()
+		if err := dec(buf, val.Index(i)); err != nil {
+			return wrapError(err, off, indexPath(i))
 		}
 	}
 
-	if listBuf.idx != len(listBuf.dat) {
-		return fmt.Errorf("did not parse entire list buffer. idx: %d, length: %d", listBuf.idx, len(listBuf.dat))
+	if i < val.Len() {
+		val.SetLen(i)
 	}
 
 	return nil
 }
 
-func (buf *buffer) seekNumItems() (int, error) {
-	if buf.idx != 0 {
-		return 0, fmt.Errorf("must call seekNumItems before beginning to seek items")
-	}
+// growSlice makes room in val, a slice of the elements decoded so far, for
+// more of them by doubling its capacity.
+func growSlice(val reflect.Value) {
+	n := val.Len()
 
-	if len(buf.dat) == 0 {
-		return 0, nil
+	newcap := 4
+	if n > 0 {
+		newcap = 2 * n
 	}
 
-	var getFunc getItem
-	if buf.dat[0] < 0xc0 {
-		getFunc = (*buffer).getBytes
-	} else {
-		getFunc = (*buffer).getList
-	}
+	slice := reflect.MakeSlice(val.Type(), n, newcap)
+	reflect.Copy(slice, val)
+	val.Set(slice)
+}
 
-	numItems := 0
-	for ; buf.idx < len(buf.dat); {
-		if _, err := getFunc(buf); err != nil {
-			return 0, fmt.Errorf("failed to seek on list index %d: %v", numItems, err)
+func (buf *buffer) decodeArrayElems(val reflect.Value, dec decoder) error {
+	i := 0
+	for ; buf.idx < len(buf.dat); i++ {
+		if i == val.Len() {
+			return ErrTooManyElements
 		}
 
-		numItems++
+		off := buf.offset()
+		if err := dec(buf, val.Index(i)); err != nil {
+			return wrapError(err, off, indexPath(i))
+		}
 	}
 
-	buf.idx = 0
+	if i < val.Len() {
+		return ErrTooFewElements
+	}
 
-	return numItems, nil
+	return nil
 }
 
 func makeStructDecoder(typ reflect.Type) (decoder, error) {
-	var err error
-
-	numField := typ.NumField()
-	decs := make([]decoder, numField)
+	fields, err := structFields(typ)
+	if err != nil {
+		return nil, err
+	}
 
-	for i := 0; i < typ.NumField(); i++ {
-		decs[i], err = getDecoder(typ.Field(i).Type)
+	decs := make([]decoder, len(fields))
+	for i, f := range fields {
+		switch {
+		case f.tags.tail:
+			decs[i], err = makeTailDecoder(f.typ)
+		case f.tags.nilOK:
+			decs[i], err = makeNilPtrDecoder(f.typ)
+		default:
+			decs[i], err = getDecoderLocked(f.typ)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -323,50 +819,119 @@ func makeStructDecoder(typ reflect.Type) (decoder, error) {
 			return err
 		}
 
-		listBuf := newBuffer(listDat)
+		listBuf := buf.sub(listDat)
+
+		for i, f := range fields {
+			v1 := val.Field(f.idx)
 
-		for i := 0; i < numField; i++ {
-			v1 := val.Field(i)
+			if listBuf.idx == len(listBuf.dat) && f.tags.optional {
+				// The list ended early. Missing optional fields
+				// are left at their zero value.
+				v1.Set(reflect.Zero(v1.Type()))
+				continue
+			}
 
+			off := listBuf.offset()
 			if err := decs[i](listBuf, v1); err != nil {
-				return err
+				return wrapError(err, off, "."+f.name)
 			}
 		}
 
 		if listBuf.idx != len(listBuf.dat) {
-			return fmt.Errorf("did not parse entire list buffer. idx: %d, length: %d", listBuf.idx, len(listBuf.dat))
+			return ErrTooManyElements
 		}
 
 		return nil
 	}, nil
 }
 
-type getItem func(*buffer) ([]byte, error)
+// makeTailDecoder returns a decoder for an rlp:"tail" field. Instead of
+// reading a list of its own, it collects the remaining elements of the
+// enclosing list.
+func makeTailDecoder(typ reflect.Type) (decoder, error) {
+	dec, err := getDecoderLocked(typ.Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	return func(buf *buffer, val reflect.Value) error {
+		return buf.decodeSliceElems(val, dec)
+	}, nil
+}
+
+// makeNilPtrDecoder returns a decoder for an rlp:"nil" field, which sets the
+// pointer to nil when the input is the empty value of the element's kind.
+func makeNilPtrDecoder(typ reflect.Type) (decoder, error) {
+	dec, err := getDecoderLocked(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := defaultNilKind(typ.Elem())
+	return func(buf *buffer, val reflect.Value) error {
+		dat := buf.getCurrentSlice()
+		if len(dat) > 0 && dat[0] == byte(kind) {
+			buf.idx++
+			val.Set(reflect.Zero(typ))
+			return nil
+		}
+
+		return dec(buf, val)
+	}, nil
+}
+
+// getRaw returns the next item including its header.
+func (buf *buffer) getRaw() ([]byte, error) {
+	dat := buf.getCurrentSlice()
+	if len(dat) == 0 {
+		return nil, buf.errEnd()
+	}
+
+	start := buf.idx
+
+	var err error
+	if dat[0] < 0xc0 {
+		_, err = buf.getBytes()
+	} else {
+		_, err = buf.getList()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.dat[start:buf.idx], nil
+}
 
 func (buf *buffer) getList() ([]byte, error) {
 	var bytes []byte
 
 	dat := buf.getCurrentSlice()
 	numBytes := len(dat)
+	if numBytes == 0 {
+		return nil, buf.errEnd()
+	}
+
 	if dat[0] < 0xc0 {
-		return nil, fmt.Errorf("invalid leading byte: %x", dat[0])
-	} else if dat[0] < 0xf8 {
+		return nil, ErrExpectedList
+	}
+
+	if max := buf.opts.MaxDepth; max > 0 && buf.depth >= max {
+		return nil, ErrTooDeep
+	}
+
+	if dat[0] < 0xf8 {
 		siz := int(dat[0] - 0xc0)
 		if 1+siz > numBytes {
-			return nil, fmt.Errorf("reached end of buffer")
+			return nil, buf.errTruncated()
 		}
 
 		bytes = dat[1:1+siz]
 		buf.idx += 1+siz
 	} else {
 		headerSiz := uint(dat[0] - 0xf7)
-		if 1+headerSiz > uint(numBytes) {
-			return nil, fmt.Errorf("reached end of buffer")
-		}
-
-		siz := buf.decodeBigEndian(dat[1:1+headerSiz])
-		if 1+headerSiz+siz > uint(numBytes) {
-			return nil, fmt.Errorf("reached end of buffer")
+		siz, err := buf.getLongSize(dat, headerSiz)
+		if err != nil {
+			return nil, err
 		}
 
 		bytes = dat[1+headerSiz:1+headerSiz+siz]
@@ -381,48 +946,73 @@ func (buf *buffer) getBytes() ([]byte, error) {
 
 	dat := buf.getCurrentSlice()
 	numBytes := len(dat)
+	if numBytes == 0 {
+		return nil, buf.errEnd()
+	}
+
 	if dat[0] < 0x80 {
 		bytes = dat[:1]
 		buf.idx++
-	} else if dat[0] < 0xb7 {
+	} else if dat[0] < 0xb8 {
 		siz := int(dat[0] - 0x80)
 		if 1+siz > numBytes {
-			return nil, fmt.Errorf("reached end of buffer")
+			return nil, buf.errTruncated()
+		}
+
+		if siz == 1 && dat[1] < 0x80 && !buf.opts.Lenient {
+			return nil, ErrCanonSingleByte
 		}
 
 		bytes = dat[1:1+siz]
 		buf.idx += 1 + siz
 	} else if dat[0] < 0xc0 {
 		headerSiz := uint(dat[0] - 0xb7)
-		if 1+headerSiz > uint(numBytes) {
-			return nil, fmt.Errorf("reached end of buffer")
-		}
-
-		siz := buf.decodeBigEndian(dat[1:1+headerSiz])
-		if 1+headerSiz+siz > uint(numBytes) {
-			return nil, fmt.Errorf("reached end of buffer")
+		siz, err := buf.getLongSize(dat, headerSiz)
+		if err != nil {
+			return nil, err
 		}
 
 		bytes = dat[1+headerSiz:1+headerSiz+siz]
 		// TODO: Can idx be int?
 		buf.idx += 1 + int(headerSiz+siz)
 	} else {
-		return nil, fmt.Errorf("invalid leading byte: %x", dat[0])
+		return nil, ErrExpectedString
 	}
 
 	return bytes, nil
 }
 
+// getLongSize reads the payload size of a long-form header. headerSiz is the
+// number of size bytes that follow the leading byte of dat.
+func (buf *buffer) getLongSize(dat []byte, headerSiz uint) (uint, error) {
+	if 1+headerSiz > uint(len(dat)) {
+		return 0, buf.errTruncated()
+	}
+
+	sizDat := dat[1 : 1+headerSiz]
+	siz := buf.decodeBigEndian(sizDat)
+	if !buf.opts.Lenient && (sizDat[0] == 0 || siz < 56) {
+		return 0, ErrCanonSize
+	}
+
+	if siz > uint(len(dat))-1-headerSiz {
+		return 0, buf.errTruncated()
+	}
+
+	return siz, nil
+}
+
 func (buf *buffer) decodeString(val reflect.Value) error {
 	bs, err := buf.getBytes()
 	if err != nil {
 		return err
 	}
 
-	str := string(bs)
-
-	// TODO: Optimize to allocate bytes once (instead of twice)
-	val.SetString(str)
+	if buf.alias && len(bs) > 0 {
+		val.SetString(unsafe.String(&bs[0], len(bs)))
+	} else {
+		val.SetString(string(bs))
+	}
 
 	return nil
 }
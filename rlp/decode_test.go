@@ -1,12 +1,17 @@
 package rlp
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"math/big"
 	"fmt"
 	"reflect"
 	"encoding/hex"
 	"strings"
 	"testing"
+
+	"github.com/rawfalafel/ethereum-toolbox/u256"
 )
 
 type struct1 struct {
@@ -69,6 +74,11 @@ var testcases = []testcase{
 	{ val: big.NewInt(1), ptr: new(*big.Int), dat: "01" },
 	{ val: veryBigInt, ptr: new(*big.Int), dat: "89FFFFFFFFFFFFFFFFFF" },
 	{ val: *big.NewInt(16), ptr: new(big.Int), dat: "10" },
+	// 256-bit integers
+	{ val: u256.Uint256{}, ptr: new(u256.Uint256), dat: "80" },
+	{ val: u256.Uint256{0x80}, ptr: new(u256.Uint256), dat: "8180" },
+	{ val: u256.Uint256{0, 1}, ptr: new(u256.Uint256), dat: "89010000000000000000" },
+	{ val: u256.NewUint256(5), ptr: new(*u256.Uint256), dat: "05" },
 	// byte arrays
 	{ val: [1]byte{2}, ptr: new([1]byte), dat: "02" },
 	{ val: [1]byte{128}, ptr: new([1]byte), dat: "8180" },
@@ -106,6 +116,735 @@ func TestDecode(t *testing.T) {
 	}
 }
 
+func TestDecodeReader(t *testing.T) {
+	for _, testcase := range testcases {
+		dat, err := hex.DecodeString(stripWhitespace(testcase.dat))
+		if err != nil {
+			t.Errorf("error parsing hex string: %v", err)
+		}
+
+		ptr := reflect.New(reflect.TypeOf(testcase.ptr).Elem()).Interface()
+		if err := Decode(bytes.NewReader(dat), ptr); err != nil {
+			t.Errorf("error decoding: %v", err)
+		}
+
+		dref := reflect.ValueOf(ptr).Elem().Interface()
+		if !reflect.DeepEqual(dref, testcase.val) {
+			t.Errorf("value different from expected output\nexpected: %v\nresult: %v", testcase.val, dref)
+		}
+	}
+}
+
+func TestDecodeReaderSequence(t *testing.T) {
+	dat, _ := hex.DecodeString("83646f67" + "c88361626383646566" + "05")
+	r := bytes.NewReader(dat)
+
+	str := new(string)
+	if err := Decode(r, str); err != nil || *str != "dog" {
+		t.Errorf("first item: got %q, err %v", *str, err)
+	}
+
+	s1 := new(struct1)
+	if err := Decode(r, s1); err != nil || *s1 != (struct1{A: "abc", B: "def"}) {
+		t.Errorf("second item: got %v, err %v", *s1, err)
+	}
+
+	u := new(uint)
+	if err := Decode(r, u); err != nil || *u != 5 {
+		t.Errorf("third item: got %d, err %v", *u, err)
+	}
+
+	if err := Decode(r, u); err != io.EOF {
+		t.Errorf("expected io.EOF after last item, got %v", err)
+	}
+}
+
+func TestDecodeReaderTruncated(t *testing.T) {
+	inputs := []string{
+		"83646f",           // short string missing a byte
+		"b8",               // long string missing its size
+		"b90400",           // long string missing its payload
+		"c883616263836465", // list missing a byte
+		"f90200",           // long list missing its payload
+	}
+
+	for _, input := range inputs {
+		dat, _ := hex.DecodeString(input)
+		if err := Decode(bytes.NewReader(dat), new(interface{})); err != io.ErrUnexpectedEOF {
+			t.Errorf("input %s: expected io.ErrUnexpectedEOF, got %v", input, err)
+		}
+	}
+}
+
+// testWrapper encodes as a single-element list and decodes through a pointer
+// receiver.
+type testWrapper struct {
+	N uint
+}
+
+func (w testWrapper) EncodeRLP(out io.Writer) error {
+	return Encode(out, []uint{w.N})
+}
+
+func (w *testWrapper) DecodeRLP(s *Stream) error {
+	var l []uint
+	if err := s.Decode(&l); err != nil {
+		return err
+	}
+
+	if len(l) != 1 {
+		return fmt.Errorf("expected one element, got %d", len(l))
+	}
+
+	w.N = l[0]
+	return nil
+}
+
+// valueDecoder implements Decoder with a value receiver.
+type valueDecoder struct {
+	raw *[]byte
+}
+
+func (d valueDecoder) DecodeRLP(s *Stream) error {
+	raw, err := s.Raw()
+	*d.raw = raw
+	return err
+}
+
+// lazyDecoder doesn't consume its input.
+type lazyDecoder struct{}
+
+func (d *lazyDecoder) DecodeRLP(s *Stream) error {
+	return nil
+}
+
+func TestDecoderInterface(t *testing.T) {
+	in := struct1Wrapped{A: "abc", W: testWrapper{N: 7}, P: &testWrapper{N: 9}}
+	dat, err := EncodeToBytes(in)
+	if err != nil {
+		t.Fatalf("error encoding: %v", err)
+	}
+
+	out := new(struct1Wrapped)
+	if err := DecodeBytes(dat, out); err != nil {
+		t.Fatalf("error decoding: %v", err)
+	}
+
+	if !reflect.DeepEqual(*out, in) {
+		t.Errorf("round trip mismatch\nexpected: %+v\nresult: %+v", in, *out)
+	}
+
+	ws := new([]testWrapper)
+	if err := DecodeBytes(unhex("C4C101C102"), ws); err != nil {
+		t.Fatalf("error decoding slice: %v", err)
+	}
+
+	if !reflect.DeepEqual(*ws, []testWrapper{{1}, {2}}) {
+		t.Errorf("unexpected slice: %v", *ws)
+	}
+
+	var raw []byte
+	if err := DecodeBytes(unhex("C20102"), &valueDecoder{&raw}); err != nil {
+		t.Fatalf("error decoding into value receiver: %v", err)
+	}
+
+	if !bytes.Equal(raw, unhex("C20102")) {
+		t.Errorf("value receiver got %x", raw)
+	}
+
+	if err := DecodeBytes(unhex("C20102"), new(lazyDecoder)); !errors.Is(err, ErrNotConsumed) {
+		t.Errorf("expected ErrNotConsumed for Decoder that does not consume its input, got %v", err)
+	}
+
+	// The error points at the first unread byte of the element.
+	err = DecodeBytes(unhex("C3C20102"), new([]lazyDecoder))
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Err != ErrNotConsumed || de.Offset != 1 || de.Path != "[0]" {
+		t.Errorf("unexpected error for unconsumed list element: %v", err)
+	}
+}
+
+func TestDecodeInterface(t *testing.T) {
+	tests := []struct {
+		dat string
+		val interface{}
+	}{
+		{dat: "05", val: []byte{5}},
+		{dat: "80", val: []byte{}},
+		{dat: "83646f67", val: []byte("dog")},
+		{dat: "c0", val: []interface{}{}},
+		{
+			// [ [], [[]], [ [], [[]] ] ]
+			dat: "C7C0C1C0C3C0C1C0",
+			val: []interface{}{
+				[]interface{}{},
+				[]interface{}{[]interface{}{}},
+				[]interface{}{[]interface{}{}, []interface{}{[]interface{}{}}},
+			},
+		},
+		{
+			dat: "CE0183FFFFFFC4C304050583616263",
+			val: []interface{}{
+				[]byte{1},
+				[]byte{0xff, 0xff, 0xff},
+				[]interface{}{[]interface{}{[]byte{4}, []byte{5}, []byte{5}}},
+				[]byte("abc"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		dat := unhex(test.dat)
+
+		var v interface{}
+		if err := DecodeBytes(dat, &v); err != nil {
+			t.Errorf("input %s: error decoding: %v", test.dat, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(v, test.val) {
+			t.Errorf("input %s: value mismatch\nexpected: %#v\nresult: %#v", test.dat, test.val, v)
+			continue
+		}
+
+		out, err := EncodeToBytes(v)
+		if err != nil {
+			t.Errorf("input %s: error re-encoding: %v", test.dat, err)
+		} else if !bytes.Equal(out, dat) {
+			t.Errorf("input %s: round trip produced %x", test.dat, out)
+		}
+	}
+
+	var r fmt.Stringer
+	if err := DecodeBytes(unhex("05"), &r); err == nil {
+		t.Errorf("expected error decoding into non-empty interface")
+	}
+}
+
+type hasUnexportedField struct {
+	A uint
+	b uint
+	C string
+}
+
+type nilPtrStruct struct {
+	U *uint         `rlp:"nil"`
+	S *struct2      `rlp:"nil"`
+	L *[]string     `rlp:"nil"`
+	B *[]byte       `rlp:"nil"`
+	P *simplestruct `rlp:"nil"`
+}
+
+type tailUints struct {
+	A    uint
+	Tail []uint `rlp:"tail"`
+}
+
+func TestDecodeStructTags(t *testing.T) {
+	var five uint = 5
+	tests := []struct {
+		dat string
+		ptr interface{}
+		val interface{}
+	}{
+		{dat: "C20103", ptr: new(hasIgnoredField), val: hasIgnoredField{A: 1, C: 3}},
+		{dat: "C50183616263", ptr: new(hasUnexportedField), val: hasUnexportedField{A: 1, C: "abc"}},
+		{dat: "C3010203", ptr: new(tailRaw), val: tailRaw{A: 1, Tail: []RawValue{unhex("02"), unhex("03")}}},
+		{dat: "C101", ptr: new(tailRaw), val: tailRaw{A: 1, Tail: []RawValue{}}},
+		{dat: "C50102030405", ptr: new(tailUints), val: tailUints{A: 1, Tail: []uint{2, 3, 4, 5}}},
+		{dat: "C101", ptr: new(optionalFields), val: optionalFields{A: 1}},
+		{dat: "C3018003", ptr: new(optionalFields), val: optionalFields{A: 1, C: 3}},
+		{dat: "C3010203", ptr: new(optionalFields), val: optionalFields{A: 1, B: 2, C: 3}},
+		{dat: "C101", ptr: new(optionalPtrField), val: optionalPtrField{A: 1}},
+		{dat: "C20102", ptr: new(optionalPtrField), val: optionalPtrField{A: 1, B: big.NewInt(2)}},
+		{dat: "C101", ptr: new(optionalAndTail), val: optionalAndTail{A: 1, Tail: []uint{}}},
+		{dat: "C401020304", ptr: new(optionalAndTail), val: optionalAndTail{A: 1, B: 2, Tail: []uint{3, 4}}},
+		{dat: "C580C0C080C0", ptr: new(nilPtrStruct), val: nilPtrStruct{}},
+		{
+			dat: "CD05C20102C18083010203C28080",
+			ptr: new(nilPtrStruct),
+			val: nilPtrStruct{U: &five, S: &struct2{A: 1, B: 2}, L: &[]string{""}, B: &[]byte{1, 2, 3}, P: &simplestruct{}},
+		},
+	}
+
+	for _, test := range tests {
+		if err := DecodeBytes(unhex(test.dat), test.ptr); err != nil {
+			t.Errorf("input %s: error decoding: %v", test.dat, err)
+			continue
+		}
+
+		dref := reflect.ValueOf(test.ptr).Elem().Interface()
+		if !reflect.DeepEqual(dref, test.val) {
+			t.Errorf("input %s: value mismatch\nexpected: %+v\nresult: %+v", test.dat, test.val, dref)
+		}
+
+		// Every input is canonical, so encoding the result gives it back.
+		enc, err := EncodeToBytes(test.ptr)
+		if err != nil || !bytes.Equal(enc, unhex(test.dat)) {
+			t.Errorf("input %s: re-encoding got (%X, %v)", test.dat, enc, err)
+		}
+	}
+
+	partial := &optionalFields{A: 9, B: 9, C: 9}
+	if err := DecodeBytes(unhex("C20102"), partial); err != nil {
+		t.Errorf("error decoding into populated struct: %v", err)
+	} else if *partial != (optionalFields{A: 1, B: 2}) {
+		t.Errorf("missing optional fields were not cleared: %+v", *partial)
+	}
+
+	if err := DecodeBytes(unhex("C0"), new(optionalFields)); err == nil {
+		t.Errorf("expected error for missing required field")
+	}
+
+	var notOptional struct {
+		A uint `rlp:"optional"`
+		B uint
+	}
+	if err := DecodeBytes(unhex("C0"), &notOptional); err == nil {
+		t.Errorf("expected error for required field after optional field")
+	}
+
+	var bad struct {
+		A uint `rlp:"nil"`
+	}
+	if err := DecodeBytes(unhex("C101"), &bad); err == nil {
+		t.Errorf("expected error for nil tag on a non-pointer field")
+	}
+}
+
+func TestDecodeCanonical(t *testing.T) {
+	tests := []struct {
+		dat string
+		ptr interface{}
+		err error
+		val interface{} // result when decoding leniently
+	}{
+		// single byte wrapped in a string header
+		{dat: "8105", ptr: new(uint), err: ErrCanonSingleByte, val: uint(5)},
+		{dat: "817f", ptr: new([]byte), err: ErrCanonSingleByte, val: []byte{0x7f}},
+		// long-form headers for short payloads
+		{dat: "b803616263", ptr: new(string), err: ErrCanonSize, val: "abc"},
+		{dat: "f8028080", ptr: new([]uint), err: ErrCanonSize, val: []uint{0, 0}},
+		// sizes with leading zeros
+		{dat: "b90038" + strings.Repeat("61", 56), ptr: new(string), err: ErrCanonSize, val: strings.Repeat("a", 56)},
+		{dat: "f90038" + strings.Repeat("80", 56), ptr: new([]uint), err: ErrCanonSize, val: make([]uint, 56)},
+		// integers with leading zeros
+		{dat: "00", ptr: new(uint), err: ErrCanonInt, val: uint(0)},
+		{dat: "820001", ptr: new(uint16), err: ErrCanonInt, val: uint16(1)},
+		{dat: "820001", ptr: new(*big.Int), err: ErrCanonInt, val: big.NewInt(1)},
+		// values too large for the target type
+		{dat: "820100", ptr: new(uint8), err: ErrValueTooLarge},
+		{dat: "83010000", ptr: new(uint16), err: ErrValueTooLarge},
+		{dat: "850100000000", ptr: new(uint32), err: ErrValueTooLarge},
+		{dat: "89010000000000000000", ptr: new(uint64), err: ErrValueTooLarge},
+		{dat: "8300ffff", ptr: new(uint16), err: ErrCanonInt, val: uint16(0xffff)},
+		{dat: "8105", ptr: new(u256.Uint256), err: ErrCanonSingleByte, val: u256.Uint256{5}},
+		{dat: "820001", ptr: new(u256.Uint256), err: ErrCanonInt, val: u256.Uint256{1}},
+		{dat: "a1" + strings.Repeat("ff", 33), ptr: new(u256.Uint256), err: ErrValueTooLarge},
+		{dat: "a100" + strings.Repeat("ff", 32), ptr: new(u256.Uint256), err: ErrCanonInt, val: u256.Uint256{^uint64(0), ^uint64(0), ^uint64(0), ^uint64(0)}},
+	}
+
+	lenient := &DecodeOptions{Lenient: true}
+	for _, test := range tests {
+		dat := unhex(test.dat)
+		typ := reflect.TypeOf(test.ptr).Elem()
+
+		if err := DecodeBytes(dat, reflect.New(typ).Interface()); !errors.Is(err, test.err) {
+			t.Errorf("input %s: expected error %v, got %v", test.dat, test.err, err)
+		}
+
+		ptr := reflect.New(typ)
+		err := lenient.DecodeBytes(dat, ptr.Interface())
+		if test.val == nil {
+			if err == nil {
+				t.Errorf("input %s: expected lenient decoding to fail", test.dat)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("input %s: unexpected error decoding leniently: %v", test.dat, err)
+		} else if !reflect.DeepEqual(ptr.Elem().Interface(), test.val) {
+			t.Errorf("input %s: lenient result %v, expected %v", test.dat, ptr.Elem().Interface(), test.val)
+		}
+	}
+}
+
+type errHeader struct {
+	ParentHash [4]byte
+	Number     uint32
+	Extra      []byte
+}
+
+type errTx struct {
+	Nonce uint
+	Data  []byte
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		dat    string
+		ptr    interface{}
+		err    error
+		offset int
+		path   string
+	}{
+		{dat: "", ptr: new(uint), err: io.EOF, path: "uint"},
+		{dat: "820102", ptr: new(uint8), err: ErrValueTooLarge, path: "uint8"},
+		{dat: "C0", ptr: new(string), err: ErrExpectedString, path: "string"},
+		{dat: "05", ptr: new([]uint), err: ErrExpectedList},
+		{dat: "8361", ptr: new(string), err: io.ErrUnexpectedEOF, path: "string"},
+		{dat: "0505", ptr: new(uint), err: ErrMoreThanOneValue, offset: 1},
+		{dat: "02", ptr: new(bool), err: ErrInvalidBool, path: "bool"},
+		{dat: "820102", ptr: new([3]byte), err: ErrByteArrayLength},
+		{dat: "C20102", ptr: new([3]uint), err: ErrTooFewElements},
+		{dat: "C401020304", ptr: new([3]uint), err: ErrTooManyElements},
+
+		// errors inside structs and lists carry the path and offset
+		{dat: "CB8401020304850102030405", ptr: new(errHeader), err: ErrValueTooLarge, offset: 6, path: "errHeader.Number"},
+		{dat: "C68401020304C0", ptr: new(errHeader), err: ErrExpectedString, offset: 6, path: "errHeader.Number"},
+		{dat: "C6840102030405", ptr: new(errHeader), err: ErrTooFewElements, offset: 7, path: "errHeader.Extra"},
+		{dat: "C9840102030405808080", ptr: new(errHeader), err: ErrTooManyElements, path: "errHeader"},
+		{dat: "C7840102030405B8", ptr: new(errHeader), err: ErrElemTooLarge, offset: 7, path: "errHeader.Extra"},
+		{dat: "C7C20180C3028105", ptr: new([]errTx), err: ErrCanonSingleByte, offset: 6, path: "[1].Data"},
+		{dat: "C7C20180C3020080", ptr: new([]errTx), err: ErrTooManyElements, offset: 4, path: "[1]"},
+		{dat: "C4C3C281FF", ptr: new([][]errTx), err: ErrTooFewElements, offset: 5, path: "[0][0].Data"},
+	}
+
+	for _, test := range tests {
+		err := DecodeBytes(unhex(test.dat), test.ptr)
+		if !errors.Is(err, test.err) {
+			t.Errorf("input %s: expected error %v, got %v", test.dat, test.err, err)
+			continue
+		}
+
+		var de *DecodeError
+		if !errors.As(err, &de) {
+			if test.offset != 0 || test.path != "" {
+				t.Errorf("input %s: expected a DecodeError, got %v", test.dat, err)
+			}
+			continue
+		}
+
+		if de.Offset != test.offset || de.Path != test.path {
+			t.Errorf("input %s: error at offset %d, path %q; expected offset %d, path %q", test.dat, de.Offset, de.Path, test.offset, test.path)
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	tests := []struct {
+		opts DecodeOptions
+		dat  string
+		ptr  interface{}
+		err  error
+	}{
+		{opts: DecodeOptions{MaxInputSize: 3}, dat: "83616263", ptr: new(string), err: ErrInputTooLarge},
+		{opts: DecodeOptions{MaxInputSize: 4}, dat: "83616263", ptr: new(string)},
+		{opts: DecodeOptions{MaxDepth: 2}, dat: "C3C2C101", ptr: new(interface{}), err: ErrTooDeep},
+		{opts: DecodeOptions{MaxDepth: 2}, dat: "C3C2C101", ptr: new([][][]uint), err: ErrTooDeep},
+		{opts: DecodeOptions{MaxDepth: 3}, dat: "C3C2C101", ptr: new([][][]uint)},
+		{opts: DecodeOptions{MaxDepth: 1}, dat: "C3C20102", ptr: new([][]uint), err: ErrTooDeep},
+		{opts: DecodeOptions{MaxListElems: 3}, dat: "C401020304", ptr: new([]uint), err: ErrListTooLong},
+		{opts: DecodeOptions{MaxListElems: 3}, dat: "C401020304", ptr: new(interface{}), err: ErrListTooLong},
+		{opts: DecodeOptions{MaxListElems: 2}, dat: "C401020304", ptr: new(tailUints), err: ErrListTooLong},
+		{opts: DecodeOptions{MaxListElems: 4}, dat: "C401020304", ptr: new([]uint)},
+		{opts: DecodeOptions{MaxBigIntBits: 16}, dat: "83010000", ptr: new(*big.Int), err: ErrBigIntTooLarge},
+		{opts: DecodeOptions{MaxBigIntBits: 17}, dat: "83010000", ptr: new(*big.Int)},
+		{opts: DecodeOptions{MaxBigIntBits: 16}, dat: "82FFFF", ptr: new(big.Int)},
+	}
+
+	for i, test := range tests {
+		dat := unhex(test.dat)
+		typ := reflect.TypeOf(test.ptr).Elem()
+
+		if err := test.opts.DecodeBytes(dat, reflect.New(typ).Interface()); !errors.Is(err, test.err) {
+			t.Errorf("test %d: DecodeBytes returned %v, expected %v", i, err, test.err)
+		}
+
+		if err := test.opts.Decode(bytes.NewReader(dat), reflect.New(typ).Interface()); !errors.Is(err, test.err) {
+			t.Errorf("test %d: Decode returned %v, expected %v", i, err, test.err)
+		}
+	}
+
+	// The size limit is checked against the header, before the payload
+	// is read.
+	opts := DecodeOptions{MaxInputSize: 1024}
+	if err := opts.Decode(bytes.NewReader(unhex("BB7FFFFFFF")), new([]byte)); !errors.Is(err, ErrInputTooLarge) {
+		t.Errorf("expected ErrInputTooLarge for oversized header, got %v", err)
+	}
+	// A size that overflows int still runs into the limit first.
+	huge := unhex("BFFFFFFFFFFFFFFFFF")
+	if err := opts.Decode(bytes.NewReader(huge), new([]byte)); !errors.Is(err, ErrInputTooLarge) {
+		t.Errorf("expected ErrInputTooLarge for overflowing header, got %v", err)
+	}
+	if err := Decode(bytes.NewReader(huge), new([]byte)); !errors.Is(err, ErrSizeOverflow) {
+		t.Errorf("expected ErrSizeOverflow without a limit, got %v", err)
+	}
+}
+
+type rawFields struct {
+	A   uint
+	Raw RawValue
+	B   string
+}
+
+func TestDecodeRawValue(t *testing.T) {
+	tests := []struct {
+		dat string
+		ptr interface{}
+		val interface{}
+	}{
+		{dat: "05", ptr: new(RawValue), val: RawValue(unhex("05"))},
+		{dat: "C20102", ptr: new(RawValue), val: RawValue(unhex("C20102"))},
+		{dat: "C40182FFFF", ptr: new([]RawValue), val: []RawValue{unhex("01"), unhex("82FFFF")}},
+		{dat: "C6C3C201028180", ptr: new([]RawValue), val: []RawValue{unhex("C3C20102"), unhex("8180")}},
+		{dat: "C501C2010262", ptr: new(rawFields), val: rawFields{A: 1, Raw: unhex("C20102"), B: "b"}},
+	}
+
+	for _, test := range tests {
+		dat := unhex(test.dat)
+		if err := DecodeBytes(dat, test.ptr); err != nil {
+			t.Errorf("input %s: error decoding: %v", test.dat, err)
+			continue
+		}
+
+		dref := reflect.ValueOf(test.ptr).Elem().Interface()
+		if !reflect.DeepEqual(dref, test.val) {
+			t.Errorf("input %s: value mismatch\nexpected: %x\nresult: %x", test.dat, test.val, dref)
+		}
+
+		out, err := EncodeToBytes(test.ptr)
+		if err != nil {
+			t.Errorf("input %s: error re-encoding: %v", test.dat, err)
+		} else if !bytes.Equal(out, dat) {
+			t.Errorf("input %s: round trip produced %x", test.dat, out)
+		}
+	}
+
+	if err := DecodeBytes(unhex("C20183"), new(rawFields)); !errors.Is(err, ErrElemTooLarge) {
+		t.Errorf("expected ErrElemTooLarge for truncated raw value, got %v", err)
+	}
+}
+
+type treeNode struct {
+	Value    uint
+	Children []*treeNode
+}
+
+type forestNode struct {
+	Name  string
+	Trees []forestNode
+	Link  *forestNode `rlp:"nil"`
+}
+
+type badRecursive struct {
+	Next *badRecursive `rlp:"nil"`
+	M    map[string]uint
+}
+
+type aliasFields struct {
+	Bytes []byte
+	Str   string
+	Raw   RawValue
+	Any   interface{}
+}
+
+func TestDecodeAliasInput(t *testing.T) {
+	enc, err := EncodeToBytes(&aliasFields{Bytes: []byte("abc"), Str: "def", Raw: unhex("83676869"), Any: []byte("jkl")})
+	if err != nil {
+		t.Fatalf("EncodeToBytes failed: %v", err)
+	}
+
+	clobber := func(dat []byte) {
+		for i := range dat {
+			if 'a' <= dat[i] && dat[i] <= 'z' {
+				dat[i] = 'x'
+			}
+		}
+	}
+
+	// By default decoded values are copies, so changing the input
+	// afterwards doesn't affect them.
+	dat := append([]byte{}, enc...)
+	var copied aliasFields
+	if err := DecodeBytes(dat, &copied); err != nil {
+		t.Fatalf("DecodeBytes failed: %v", err)
+	}
+	clobber(dat)
+	if string(copied.Bytes) != "abc" || copied.Str != "def" || string(copied.Raw) != "\x83ghi" || string(copied.Any.([]byte)) != "jkl" {
+		t.Errorf("copied values changed with the input: %q", copied)
+	}
+
+	// With AliasInput they share the input's memory.
+	alias := &DecodeOptions{AliasInput: true}
+	dat = append([]byte{}, enc...)
+	var aliased aliasFields
+	if err := alias.DecodeBytes(dat, &aliased); err != nil {
+		t.Fatalf("DecodeBytes failed: %v", err)
+	}
+	clobber(dat)
+	if string(aliased.Bytes) != "xxx" || aliased.Str != "xxx" || string(aliased.Raw) != "\x83xxx" || string(aliased.Any.([]byte)) != "xxx" {
+		t.Errorf("aliased values don't share the input: %q", aliased)
+	}
+
+	// Aliasing saves an allocation per []byte, string and RawValue.
+	copyAllocs := testing.AllocsPerRun(100, func() {
+		var v aliasFields
+		DecodeBytes(enc, &v)
+	})
+	aliasAllocs := testing.AllocsPerRun(100, func() {
+		var v aliasFields
+		alias.DecodeBytes(enc, &v)
+	})
+	if copyAllocs-aliasAllocs < 4 {
+		t.Errorf("aliasing saved %v allocations, want at least 4", copyAllocs-aliasAllocs)
+	}
+
+	// Streams over a byte slice follow the option too.
+	dat = append([]byte{}, enc...)
+	s := NewByteStream(dat)
+	if _, err := s.List(); err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	b, _ := s.Bytes()
+	clobber(dat)
+	if string(b) != "abc" {
+		t.Errorf("Stream.Bytes result changed with the input: %q", b)
+	}
+}
+
+type reuseFields struct {
+	Bytes []byte
+	Ptr   *reuseInner
+	List  []reuseInner
+}
+
+type reuseInner struct {
+	A uint
+	B []byte
+}
+
+func TestDecodeReuse(t *testing.T) {
+	var v reuseFields
+	in1 := reuseFields{
+		Bytes: []byte("abcdef"),
+		Ptr:   &reuseInner{A: 1, B: []byte{}},
+		List:  []reuseInner{{A: 1, B: []byte("xyz")}, {A: 2, B: []byte{}}, {A: 3, B: []byte{}}},
+	}
+	in2 := reuseFields{
+		Bytes: []byte("ghi"),
+		Ptr:   &reuseInner{A: 2, B: []byte{}},
+		List:  []reuseInner{{A: 4, B: []byte("uv")}, {A: 5, B: []byte{}}},
+	}
+	enc1, _ := EncodeToBytes(&in1)
+	enc2, _ := EncodeToBytes(&in2)
+
+	if err := DecodeBytes(enc1, &v); err != nil {
+		t.Fatalf("DecodeBytes failed: %v", err)
+	}
+	bytesArray, ptr, listArray, innerArray := &v.Bytes[:1][0], v.Ptr, &v.List[:1][0], &v.List[0].B[:1][0]
+
+	if err := DecodeBytes(enc2, &v); err != nil {
+		t.Fatalf("DecodeBytes failed: %v", err)
+	}
+	if !reflect.DeepEqual(v, in2) {
+		t.Errorf("decoded %+v, want %+v", v, in2)
+	}
+	if &v.Bytes[0] != bytesArray || v.Ptr != ptr || &v.List[0] != listArray || &v.List[0].B[0] != innerArray {
+		t.Errorf("existing values weren't reused")
+	}
+
+	// Only the decoder's own bookkeeping allocates when the value is
+	// reused: one fewer allocation for each slice and pointer.
+	reused := testing.AllocsPerRun(100, func() {
+		if err := DecodeBytes(enc2, &v); err != nil {
+			t.Fatalf("DecodeBytes failed: %v", err)
+		}
+	})
+	fresh := testing.AllocsPerRun(100, func() {
+		var v reuseFields
+		if err := DecodeBytes(enc2, &v); err != nil {
+			t.Fatalf("DecodeBytes failed: %v", err)
+		}
+	})
+	if fresh-reused < 5 {
+		t.Errorf("reusing the value saved %v allocations, want at least 5", fresh-reused)
+	}
+
+	// Growing a slice past its capacity keeps the elements decoded so far.
+	if err := DecodeBytes(enc1, &v); err != nil {
+		t.Fatalf("DecodeBytes failed: %v", err)
+	}
+	if !reflect.DeepEqual(v, in1) {
+		t.Errorf("decoded %+v, want %+v", v, in1)
+	}
+}
+
+func TestRecursiveTypes(t *testing.T) {
+	tests := []struct {
+		val interface{}
+		dat string
+	}{
+		{val: &recstruct{5, &recstruct{4, &recstruct{3, nil}}}, dat: "C605C404C203C0"},
+		{val: &treeNode{Value: 1}, dat: "C201C0"},
+		{
+			val: &treeNode{Value: 1, Children: []*treeNode{{Value: 2}, {Value: 3, Children: []*treeNode{{Value: 4}}}}},
+			dat: "CB01C9C202C0C503C3C204C0",
+		},
+		{
+			val: &forestNode{Name: "a", Trees: []forestNode{{Name: "b"}}, Link: &forestNode{Name: "c"}},
+			dat: "CA61C4C362C0C0C363C0C0",
+		},
+	}
+
+	for _, test := range tests {
+		dat, err := EncodeToBytes(test.val)
+		if err != nil {
+			t.Errorf("error encoding %+v: %v", test.val, err)
+			continue
+		}
+
+		if !bytes.Equal(dat, unhex(test.dat)) {
+			t.Errorf("encoding mismatch\ngot   %X\nwant  %s", dat, test.dat)
+		}
+
+		// Empty lists decode as empty slices rather than nil, so compare
+		// the re-encoded value instead of the value itself.
+		out := reflect.New(reflect.TypeOf(test.val).Elem())
+		if err := DecodeBytes(dat, out.Interface()); err != nil {
+			t.Errorf("error decoding %s: %v", test.dat, err)
+			continue
+		}
+
+		if again, err := EncodeToBytes(out.Interface()); err != nil || !bytes.Equal(again, dat) {
+			t.Errorf("round trip mismatch for %s: got %X, err %v", test.dat, again, err)
+		}
+	}
+
+	if _, err := EncodeToBytes(&badRecursive{}); err == nil {
+		t.Errorf("expected error encoding unsupported recursive type")
+	}
+
+	if _, err := EncodeToBytes((*badRecursive)(nil)); err == nil {
+		t.Errorf("expected error encoding nil pointer to unsupported recursive type")
+	}
+
+	if err := DecodeBytes(unhex("C2C0C0"), new(badRecursive)); err == nil {
+		t.Errorf("expected error decoding unsupported recursive type")
+	}
+
+	if err := DecodeBytes(unhex("C0"), new(*badRecursive)); err == nil {
+		t.Errorf("expected error decoding pointer to unsupported recursive type")
+	}
+}
+
+type struct1Wrapped struct {
+	A string
+	W testWrapper
+	P *testWrapper
+}
+
 func stripWhitespace(s string) string {
 	return strings.Join(strings.Split(s, " "), "")
 }
@@ -215,4 +954,59 @@ func BenchmarkStruct2Slice(b *testing.B) {
 			b.Errorf("error decoding on run %d: %v\ndat: %xs", i, err, dat)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func BenchmarkDecodeTxs(b *testing.B) {
+	dat, err := EncodeToBytes(makeBenchTxs(1000))
+	if err != nil {
+		b.Fatalf("failed EncodeToBytes: %v", err)
+	}
+
+	b.SetBytes(int64(len(dat)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var txs []benchTx
+		if err := DecodeBytes(dat, &txs); err != nil {
+			b.Fatalf("failed DecodeBytes: %v", err)
+		}
+	}
+}
+
+func BenchmarkDecodeUintList(b *testing.B) {
+	list := make([]uint64, 10000)
+	for i := range list {
+		list[i] = uint64(i) * 1000
+	}
+	dat, err := EncodeToBytes(list)
+	if err != nil {
+		b.Fatalf("failed EncodeToBytes: %v", err)
+	}
+
+	b.SetBytes(int64(len(dat)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out []uint64
+		if err := DecodeBytes(dat, &out); err != nil {
+			b.Fatalf("failed DecodeBytes: %v", err)
+		}
+	}
+}
+
+func BenchmarkDecodeTxsReuse(b *testing.B) {
+	dat, err := EncodeToBytes(makeBenchTxs(1000))
+	if err != nil {
+		b.Fatalf("failed EncodeToBytes: %v", err)
+	}
+
+	var txs []benchTx
+	b.SetBytes(int64(len(dat)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := DecodeBytes(dat, &txs); err != nil {
+			b.Fatalf("failed DecodeBytes: %v", err)
+		}
+	}
+}
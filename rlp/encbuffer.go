@@ -0,0 +1,503 @@
+package rlp
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"sync"
+
+	"github.com/rawfalafel/ethereum-toolbox/u256"
+)
+
+// writeChunk is how much output an encBuffer streaming to a writer
+// collects before passing it on.
+const writeChunk = 4096
+
+// encBuffer collects the output of a single encoding pass. Payloads are
+// written once, in order, into str. List headers can't be written before
+// their payload is known, so list only records where a header goes and
+// listEnd its size; the headers are merged in when the output is copied out.
+//
+// If out is set, the output is streamed to it in chunks instead. Lists too
+// large for a chunk get their header written up front, computed with the
+// sizer, and everything else is buffered until no list is open. Sizing the
+// outermost such list also records the sizes of the large lists inside it,
+// so each of them is only sized once.
+type encBuffer struct {
+	str    []byte     // string data, everything except the list headers
+	lheads []listhead // all list headers, in the order they were opened
+	lhsize int        // sum of the sizes of all finished list headers
+	open   int        // number of lists opened by list and not yet ended
+
+	out    io.Writer
+	direct int       // number of open lists whose header was written up front
+	sizes  sizeCache // sizes of the large lists within the outermost one
+	opaque int       // number of Encoders writing, whose lists aren't in sizes
+}
+
+var encBufferPool = sync.Pool{
+	New: func() interface{} { return new(encBuffer) },
+}
+
+// getEncBuffer takes an empty encBuffer from the pool. Put it back with
+// encBufferPool.Put once its output has been copied out.
+func getEncBuffer() *encBuffer {
+	w := encBufferPool.Get().(*encBuffer)
+	w.reset(nil)
+	return w
+}
+
+func (w *encBuffer) reset(out io.Writer) {
+	w.str = w.str[:0]
+	w.lheads = w.lheads[:0]
+	w.lhsize = 0
+	w.open = 0
+	w.out = out
+	w.direct = 0
+	w.opaque = 0
+}
+
+type listhead struct {
+	offset int // index of this header in str
+	size   int // total size of the list payload, including nested headers
+}
+
+// encode writes the encoding of v to w.
+func (w *encBuffer) encode(v interface{}) error {
+	ei := getInfo(reflect.TypeOf(v))
+	if ei.err != nil {
+		return ei.err
+	}
+
+	return ei.w(reflect.ValueOf(v), w)
+}
+
+func (w *encBuffer) writeBool(b bool) {
+	if b {
+		w.str = append(w.str, 0x01)
+	} else {
+		w.str = append(w.str, 0x80)
+	}
+}
+
+func (w *encBuffer) writeUint64(i uint64) {
+	if i == 0 {
+		w.str = append(w.str, 0x80)
+	} else if i < 128 {
+		w.str = encodeByte(w.str, byte(i))
+	} else {
+		w.str = encodeByteHeader(w.str, getBigEndianSize(uint(i)))
+		w.str = appendBigEndian(w.str, uint(i))
+	}
+}
+
+func (w *encBuffer) writeBytes(b []byte) {
+	if len(b) == 1 {
+		w.str = encodeByte(w.str, b[0])
+	} else {
+		w.str = encodeBytes(w.str, b)
+	}
+}
+
+func (w *encBuffer) writeString(s string) {
+	if len(s) == 1 {
+		w.str = encodeByte(w.str, s[0])
+		return
+	}
+
+	w.str = encodeByteHeader(w.str, len(s))
+	w.str = append(w.str, s...)
+}
+
+// writeBigInt writes i, which may be nil, as a string. Negative numbers
+// have no encoding.
+func (w *encBuffer) writeBigInt(i *big.Int) error {
+	if i == nil {
+		w.str = append(w.str, 0x80)
+		return nil
+	}
+
+	if i.Sign() == -1 {
+		return fmt.Errorf("rlp: cannot encode negative *big.Int")
+	}
+
+	// Write the bytes straight into the buffer rather than through
+	// i.Bytes, which allocates.
+	n := (i.BitLen() + 7) / 8
+	if n == 1 {
+		w.str = encodeByte(w.str, byte(i.Uint64()))
+		return nil
+	}
+
+	w.str = encodeByteHeader(w.str, n)
+	start := len(w.str)
+	w.str = append(w.str, make([]byte, n)...)
+	i.FillBytes(w.str[start:])
+	return nil
+}
+
+func (w *encBuffer) writeUint256(z *u256.Uint256) {
+	if z.IsUint64() {
+		w.writeUint64(z.Uint64())
+		return
+	}
+
+	n := z.ByteLen()
+	w.str = encodeByteHeader(w.str, n)
+	start := len(w.str)
+	w.str = append(w.str, make([]byte, n)...)
+	z.FillBytes(w.str[start:])
+}
+
+// list opens a list and returns its index in lheads, which must be passed
+// to listEnd once the list payload has been written.
+func (w *encBuffer) list() int {
+	w.lheads = append(w.lheads, listhead{offset: len(w.str), size: w.lhsize})
+	w.open++
+	return len(w.lheads) - 1
+}
+
+func (w *encBuffer) listEnd(index int) {
+	lh := &w.lheads[index]
+	lh.size = w.size() - lh.offset - lh.size
+	w.lhsize += listHeaderSize(lh.size)
+	w.open--
+}
+
+// listStart opens the list v for the list writers. It's list, unless w is
+// streaming, isn't inside a buffered list and v's payload, as computed by
+// payload, is more than a chunk. Then the header is written right away and
+// -1 is returned. Either way the result goes to listStop.
+//
+// Only the outermost such list is sized by listStart. The sizes of large
+// lists inside it are recorded meanwhile and taken from w.sizes as they
+// are reached, so each part of the value is sized once. Lists the sizes
+// can't identify, written by Encoders or not addressable, are sized again.
+func (w *encBuffer) listStart(v reflect.Value, payload sizer) (int, error) {
+	if w.out == nil || w.open > 0 {
+		return w.list(), nil
+	}
+
+	var siz int
+	if w.direct == 0 {
+		// This is the outermost list that may be large. Size it,
+		// recording the large lists inside it, which are written
+		// before it ends. Its own record comes first.
+		w.sizes.reset()
+		var err error
+		if siz, err = payload(v, &w.sizes); err != nil {
+			return 0, err
+		}
+		w.sizes.lookup(v)
+	} else if s, ok := w.sizes.lookup(v); ok {
+		siz = s
+	} else if _, ok := makeSizedList(v); ok && w.opaque == 0 {
+		// It would have been recorded if it were large.
+		return w.list(), nil
+	} else {
+		var err error
+		if siz, err = payload(v, nil); err != nil {
+			return 0, err
+		}
+	}
+
+	if siz < writeChunk {
+		return w.list(), nil
+	}
+
+	w.str = encodeListHeader(w.str, siz)
+	w.direct++
+	return -1, nil
+}
+
+func (w *encBuffer) listStop(index int) error {
+	if index >= 0 {
+		w.listEnd(index)
+	} else {
+		w.direct--
+	}
+
+	return w.flushIfFull()
+}
+
+// flushIfFull passes the output on to out once there's at least a chunk
+// of it and no list header is missing.
+func (w *encBuffer) flushIfFull() error {
+	if w.out == nil || w.open > 0 || len(w.str) < writeChunk {
+		return nil
+	}
+
+	return w.flush()
+}
+
+// flush writes all output to out and empties the buffer. No list may be
+// open.
+func (w *encBuffer) flush() error {
+	var head [9]byte
+	strpos := 0
+	for _, lh := range w.lheads {
+		if lh.offset > strpos {
+			if _, err := w.out.Write(w.str[strpos:lh.offset]); err != nil {
+				return fmt.Errorf("failed to write: %v", err)
+			}
+			strpos = lh.offset
+		}
+
+		if _, err := w.out.Write(encodeListHeader(head[:0], lh.size)); err != nil {
+			return fmt.Errorf("failed to write: %v", err)
+		}
+	}
+
+	if strpos < len(w.str) {
+		if _, err := w.out.Write(w.str[strpos:]); err != nil {
+			return fmt.Errorf("failed to write: %v", err)
+		}
+	}
+
+	// Lists whose header was written up front may still be open, so
+	// only the output is dropped.
+	w.str = w.str[:0]
+	w.lheads = w.lheads[:0]
+	w.lhsize = 0
+	return nil
+}
+
+// size returns the length of the encoded output so far.
+func (w *encBuffer) size() int {
+	return len(w.str) + w.lhsize
+}
+
+// makeBytes returns the encoded output with the list headers in place.
+func (w *encBuffer) makeBytes() []byte {
+	out := make([]byte, w.size())
+	w.copyTo(out)
+	return out
+}
+
+// appendTo appends the encoded output to dst.
+func (w *encBuffer) appendTo(dst []byte) []byte {
+	size := w.size()
+	if n := len(dst) + size; n <= cap(dst) {
+		dst = dst[:n]
+	} else {
+		dst = append(dst, make([]byte, size)...)
+	}
+
+	w.copyTo(dst[len(dst)-size:])
+	return dst
+}
+
+func (w *encBuffer) copyTo(dst []byte) {
+	strpos, pos := 0, 0
+	for _, head := range w.lheads {
+		n := copy(dst[pos:], w.str[strpos:head.offset])
+		pos += n
+		strpos += n
+
+		// dst[pos:pos] has room for the header, so this writes in place.
+		pos += len(encodeListHeader(dst[pos:pos], head.size))
+	}
+
+	copy(dst[pos:], w.str[strpos:])
+}
+
+// Write appends b to the output as is. It lets Encoder implementations
+// write into the buffer.
+func (w *encBuffer) Write(b []byte) (int, error) {
+	w.str = append(w.str, b...)
+	return len(b), nil
+}
+
+// listHeaderSize returns the size of the header of a list whose payload
+// is size bytes long.
+func listHeaderSize(size int) int {
+	if size < 56 {
+		return 1
+	}
+
+	return 1 + getBigEndianSize(uint(size))
+}
+
+// encReader reads the output of an encBuffer, merging in the list headers
+// as it goes.
+type encReader struct {
+	buf    *encBuffer
+	lhpos  int    // next list header in buf.lheads
+	strpos int    // next unread byte of buf.str
+	piece  []byte // unread part of the current piece
+	head   [9]byte
+}
+
+func (r *encReader) Read(b []byte) (n int, err error) {
+	for {
+		if r.piece = r.next(); r.piece == nil {
+			return n, io.EOF
+		}
+
+		nn := copy(b[n:], r.piece)
+		n += nn
+		if nn < len(r.piece) {
+			// b is full.
+			r.piece = r.piece[nn:]
+			return n, nil
+		}
+
+		r.piece = nil
+	}
+}
+
+// next returns the next piece of output: either a run of string data or a
+// list header. It returns nil at the end.
+func (r *encReader) next() []byte {
+	switch {
+	case r.piece != nil:
+		return r.piece
+	case r.lhpos < len(r.buf.lheads):
+		lh := r.buf.lheads[r.lhpos]
+		if lh.offset > r.strpos {
+			p := r.buf.str[r.strpos:lh.offset]
+			r.strpos = lh.offset
+			return p
+		}
+
+		r.lhpos++
+		return encodeListHeader(r.head[:0], lh.size)
+	case r.strpos < len(r.buf.str):
+		p := r.buf.str[r.strpos:]
+		r.strpos = len(r.buf.str)
+		return p
+	}
+
+	return nil
+}
+
+// EncoderBuffer encodes values into a buffer that is kept across uses.
+// Encoding a batch of values into one EncoderBuffer, or calling Reset to
+// reuse it, avoids allocating a fresh buffer for every value.
+//
+// If the buffer has a destination writer, output is passed on to it as it
+// is produced, and Flush writes whatever is left. Otherwise ToBytes and
+// AppendToBytes return the output.
+type EncoderBuffer struct {
+	buf *encBuffer
+	// shared is set if buf belongs to the encoder that called EncodeRLP.
+	shared bool
+}
+
+// NewEncoderBuffer returns an empty EncoderBuffer writing to dst, which
+// may be nil.
+//
+// If dst is the writer passed to an EncodeRLP method, the EncoderBuffer
+// writes straight into the calling encoder's buffer, so Encoder
+// implementations can use it without copying their output.
+func NewEncoderBuffer(dst io.Writer) *EncoderBuffer {
+	w := new(EncoderBuffer)
+	w.Reset(dst)
+	return w
+}
+
+// Reset discards the buffered output and sets the destination writer to
+// dst, which may be nil. The memory of the buffer is kept for reuse.
+func (w *EncoderBuffer) Reset(dst io.Writer) {
+	switch outer := dst.(type) {
+	case *encBuffer:
+		w.buf, w.shared = outer, true
+		return
+	case *EncoderBuffer:
+		w.buf, w.shared = outer.buf, true
+		return
+	}
+
+	if w.buf == nil || w.shared {
+		w.buf, w.shared = new(encBuffer), false
+	}
+	w.buf.reset(dst)
+}
+
+// Encode appends the encoding of v. If it fails, the buffer is left in an
+// undefined state and must be Reset before it is used again.
+func (w *EncoderBuffer) Encode(v interface{}) error {
+	return w.buf.encode(v)
+}
+
+// Write appends b as is, which must already be valid RLP.
+func (w *EncoderBuffer) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+// Flush writes the buffered output to the destination writer and empties
+// the buffer. It does nothing if the output already went into the buffer of
+// an enclosing encoder.
+func (w *EncoderBuffer) Flush() error {
+	if w.shared {
+		return nil
+	}
+	if w.buf.out == nil {
+		return fmt.Errorf("rlp: EncoderBuffer has no destination writer")
+	}
+	if w.buf.open > 0 {
+		return fmt.Errorf("rlp: flushing EncoderBuffer with unfinished list")
+	}
+
+	return w.buf.flush()
+}
+
+// ToBytes returns a copy of the buffered output. All lists must be
+// finished.
+func (w *EncoderBuffer) ToBytes() []byte {
+	return w.buf.makeBytes()
+}
+
+// AppendToBytes appends the buffered output to dst. All lists must be
+// finished.
+func (w *EncoderBuffer) AppendToBytes(dst []byte) []byte {
+	return w.buf.appendTo(dst)
+}
+
+// List starts a list and returns its index. Everything written until
+// ListEnd is called with that index goes into the list. Lists nest, and
+// must be finished innermost first.
+func (w *EncoderBuffer) List() int {
+	return w.buf.list()
+}
+
+// ListEnd finishes the list whose index was returned by List.
+func (w *EncoderBuffer) ListEnd(index int) {
+	if w.buf.open == 0 {
+		panic("rlp: ListEnd called without an open list")
+	}
+
+	w.buf.listEnd(index)
+}
+
+// WriteBytes writes b as a string.
+func (w *EncoderBuffer) WriteBytes(b []byte) {
+	w.buf.writeBytes(b)
+}
+
+// WriteString writes s as a string.
+func (w *EncoderBuffer) WriteString(s string) {
+	w.buf.writeString(s)
+}
+
+// WriteUint64 writes i as an integer.
+func (w *EncoderBuffer) WriteUint64(i uint64) {
+	w.buf.writeUint64(i)
+}
+
+// WriteBigInt writes i as an integer, treating nil as zero. It fails for
+// negative numbers, which can't be encoded.
+func (w *EncoderBuffer) WriteBigInt(i *big.Int) error {
+	return w.buf.writeBigInt(i)
+}
+
+// WriteUint256 writes z as an integer.
+func (w *EncoderBuffer) WriteUint256(z *u256.Uint256) {
+	w.buf.writeUint256(z)
+}
+
+// WriteBool writes b as an integer, 1 for true and 0 for false.
+func (w *EncoderBuffer) WriteBool(b bool) {
+	w.buf.writeBool(b)
+}
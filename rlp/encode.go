@@ -6,6 +6,9 @@ import (
 	"math/big"
 	"reflect"
 	"strings"
+	"sync"
+
+	"github.com/rawfalafel/ethereum-toolbox/u256"
 )
 
 // EncodeToBytes ...
@@ -13,78 +16,259 @@ func EncodeToBytes(v interface{}) ([]byte, error) {
 	return encode(v)
 }
 
-// Encode ...
+// EncodedSize returns the size of the encoding of v, without encoding it.
+func EncodedSize(v interface{}) (int, error) {
+	ei := getInfo(reflect.TypeOf(v))
+	if ei.err != nil {
+		return 0, ei.err
+	}
+
+	return ei.s(reflect.ValueOf(v), nil)
+}
+
+// IntSize returns the encoded size of the integer i.
+func IntSize(i uint64) int {
+	if i < 128 {
+		return 1
+	}
+
+	return 1 + getBigEndianSize(uint(i))
+}
+
+// BytesSize returns the encoded size of the string b.
+func BytesSize(b []byte) int {
+	if len(b) == 1 && b[0] <= 0x7f {
+		return 1
+	}
+
+	return stringSize(len(b))
+}
+
+// ListSize returns the encoded size of a list with a payload of the given
+// size, which is the sum of the encoded sizes of its elements.
+func ListSize(payload int) int {
+	return listHeaderSize(payload) + payload
+}
+
+// stringSize returns the encoded size of a string of size bytes, other
+// than a single byte below 0x80.
+func stringSize(size int) int {
+	if size < 56 {
+		return 1 + size
+	}
+
+	return 1 + getBigEndianSize(uint(size)) + size
+}
+
+// AppendToBytes appends the encoding of v to dst and returns the extended
+// slice. If dst has enough spare capacity nothing is allocated, so reusing
+// dst across calls avoids allocating for every value.
+func AppendToBytes(dst []byte, v interface{}) ([]byte, error) {
+	w := getEncBuffer()
+	defer encBufferPool.Put(w)
+
+	if err := w.encode(v); err != nil {
+		return dst, err
+	}
+
+	return w.appendTo(dst), nil
+}
+
+// Encode writes the encoding of v to w. The output is written as it is
+// produced, so at most a few kilobytes plus the largest string in v are
+// buffered at a time.
 func Encode(w io.Writer, v interface{}) error {
-	bs, err := encode(v)
-	if err != nil {
+	buf := getEncBuffer()
+	defer encBufferPool.Put(buf)
+
+	buf.reset(w)
+	if err := buf.encode(v); err != nil {
 		return err
 	}
 
-	_, err = w.Write(bs)
-	if err != nil {
-		return fmt.Errorf("failed to write: %v", err)
+	return buf.flush()
+}
+
+// EncodeToReader returns a reader from which the encoding of v can be read,
+// along with its size. It's meant for request bodies and the like, where the
+// size has to be known up front.
+func EncodeToReader(v interface{}) (size int, r io.Reader, err error) {
+	buf := new(encBuffer)
+	if err := buf.encode(v); err != nil {
+		return 0, nil, err
 	}
 
-	return nil
+	return buf.size(), &encReader{buf: buf}, nil
 }
 
+// encode encodes v in a single pass. List headers are filled in once the
+// whole value has been written, so no value is visited twice.
 func encode(v interface{}) ([]byte, error) {
-	val := reflect.ValueOf(v)
-	typ := reflect.TypeOf(v)
+	w := getEncBuffer()
+	defer encBufferPool.Put(w)
 
-	i := getInfo(typ)
-
-	siz, err := i.s(val)
-	if err != nil {
+	if err := w.encode(v); err != nil {
 		return nil, err
 	}
 
-	bs := make([]byte, 0, siz)
-	bs = i.w(val, bs)
+	return w.makeBytes(), nil
+}
+
+var (
+	infoMu    sync.RWMutex
+	infoCache = map[reflect.Type]*encodeInfo{}
+)
+
+func getInfo(typ reflect.Type) *encodeInfo {
+	infoMu.RLock()
+	ei, ok := infoCache[typ]
+	infoMu.RUnlock()
 
-	if len(bs) != siz {
-		return nil, fmt.Errorf("Size doesn't match: %d but should be %d", len(bs), siz)
+	if ok {
+		return ei
 	}
 
-	return bs, nil
+	infoMu.Lock()
+	defer infoMu.Unlock()
+	return getInfoLocked(typ)
 }
 
-var infoCache = map[reflect.Type]*encodeInfo{}
-
-func getInfo(typ reflect.Type) *encodeInfo {
+// getInfoLocked is getInfo for callers holding infoMu, which are the
+// functions that populate an encodeInfo.
+//
+// The encodeInfo is cached before it's populated, so a recursive type gets
+// back the same, still empty, encodeInfo. That's fine as long as its sizer
+// and writer are only looked up when encoding, never while populating.
+func getInfoLocked(typ reflect.Type) *encodeInfo {
 	ei, ok := infoCache[typ]
 
 	if !ok {
 		ei = &encodeInfo{}
 		infoCache[typ] = ei
 		if err := ei.populate(typ); err != nil {
-			delete(infoCache, typ)
+			// Types populated while typ was in progress may already
+			// hold ei, so it stays cached and reports the error.
+			ei.err = err
+			ei.s = func(reflect.Value, *sizeCache) (int, error) { return 0, err }
+			ei.w = func(reflect.Value, *encBuffer) error { return err }
 		}
 	}
 
 	return ei
 }
 
-type writerz struct {
-	data []byte
+// sizer returns the encoded size of a value. The payload sizes of lists
+// within it that are large enough to be streamed are recorded in the
+// sizeCache, if it isn't nil.
+type sizer func(reflect.Value, *sizeCache) (int, error)
+type writer func(reflect.Value, *encBuffer) error
+
+// sizeCache holds the payload sizes of the large lists found by a sizer, in
+// the order they are written. Streaming to a writer needs the size of every
+// list larger than a chunk before writing it, and without the cache the
+// lists nested in one would be sized again for each list around them.
+type sizeCache struct {
+	lists []sizedList
+	next  int // the list listStart will reach next
+}
+
+// sizedList identifies a list by its type and memory: a slice by its
+// elements, anything else by its address. Lists that are neither slices nor
+// addressable aren't recorded. A list found at the same place is the same
+// value, so its size can be trusted even if the lists were reached in a
+// different order.
+type sizedList struct {
+	typ  reflect.Type
+	ptr  uintptr
+	len  int
+	size int
+}
+
+func makeSizedList(v reflect.Value) (sizedList, bool) {
+	switch {
+	case v.Kind() == reflect.Slice:
+		return sizedList{typ: v.Type(), ptr: v.Pointer(), len: v.Len()}, true
+	case v.CanAddr():
+		return sizedList{typ: v.Type(), ptr: v.UnsafeAddr()}, true
+	}
+
+	return sizedList{}, false
+}
+
+func (c *sizeCache) reset() {
+	c.lists = c.lists[:0]
+	c.next = 0
+}
+
+// start reserves a place for the list v, whose payload is about to be
+// sized, and returns the index to pass to end, or -1.
+func (c *sizeCache) start(v reflect.Value) int {
+	if c == nil {
+		return -1
+	}
+
+	l, ok := makeSizedList(v)
+	if !ok {
+		return -1
+	}
+
+	c.lists = append(c.lists, l)
+	return len(c.lists) - 1
 }
 
-func newWriter(size int) *writerz {
-	return &writerz{make([]byte, 0, size)}
+// end records the payload size of the list started at index. A list too
+// small to be streamed is dropped, along with the lists inside it.
+func (c *sizeCache) end(index, size int) {
+	if index < 0 {
+		return
+	}
+
+	if size < writeChunk {
+		c.lists = c.lists[:index]
+	} else {
+		c.lists[index].size = size
+	}
 }
 
-func (w *writerz) Write(p []byte) (int, error) {
-	w.data = append(w.data, p...)
-	return len(p), nil
+// lookup returns the payload size of v if it's the next recorded list.
+func (c *sizeCache) lookup(v reflect.Value) (int, bool) {
+	if c.next >= len(c.lists) {
+		return 0, false
+	}
+
+	l, ok := makeSizedList(v)
+	if !ok {
+		return 0, false
+	}
+
+	if rec := c.lists[c.next]; rec.typ == l.typ && rec.ptr == l.ptr && rec.len == l.len {
+		c.next++
+		return rec.size, true
+	}
+
+	return 0, false
 }
 
-type sizer func(reflect.Value) (int, error)
-type writer func(reflect.Value, []byte) []byte
+// recordSizes wraps the payload sizer of a list type so that it records the
+// sizes of large lists in c.
+func recordSizes(payload sizer) sizer {
+	return func(v reflect.Value, c *sizeCache) (int, error) {
+		index := c.start(v)
+		siz, err := payload(v, c)
+		if err != nil {
+			return 0, err
+		}
+
+		c.end(index, siz)
+		return siz, nil
+	}
+}
 
 type encodeInfo struct {
 	typ reflect.Type
 	s   sizer
 	w   writer
+	err error
 }
 
 func (ei *encodeInfo) populate(typ reflect.Type) error {
@@ -96,14 +280,20 @@ func (ei *encodeInfo) populate(typ reflect.Type) error {
 
 	kind := typ.Kind()
 	switch {
-	case typ.Implements(encoderInterface):
+	case encodeFuncs[typ] != nil:
+		ei.s, ei.w = makeRegisteredFuncs(encodeFuncs[typ])
+	case typ.Implements(encoderInterface), reflect.PtrTo(typ).Implements(encoderInterface):
 		ei.s, ei.w = makeEncoderFuncs(typ)
+	case typ == rawValueType:
+		ei.s, ei.w = rawValueSizer, rawValueWriter
 	case kind == reflect.Interface:
 		ei.s, ei.w = interfaceSizer, interfaceWriter
 	case typ.AssignableTo(bigIntPtr):
 		ei.s, ei.w = bigIntPtrSizer, bigIntPtrWriter
 	case typ.AssignableTo(bigInt):
 		ei.s, ei.w = bigIntNoPtrSizer, bigIntNoPtrWriter
+	case typ == uint256Type:
+		ei.s, ei.w = uint256Sizer, uint256Writer
 	case isUint(kind):
 		ei.s, ei.w = uintSizer, uintWriter
 	case kind == reflect.String:
@@ -117,10 +307,13 @@ func (ei *encodeInfo) populate(typ reflect.Type) error {
 	case kind == reflect.Slice || kind == reflect.Array:
 		ei.s, ei.w = makeSliceFuncs(typ)
 	case kind == reflect.Struct:
-		s, w, _ := makeStructFuncs(typ)
+		s, w, err := makeStructFuncs(typ)
+		if err != nil {
+			return err
+		}
 		ei.s, ei.w = s, w
 	case kind == reflect.Ptr:
-		ei.s, ei.w = makePtrFuncs(typ)
+		ei.s, ei.w = makePtrFuncs(typ, defaultNilKind(typ.Elem()))
 	default:
 		return fmt.Errorf("typ %v is not RLP-serializable", typ)
 	}
@@ -128,60 +321,71 @@ func (ei *encodeInfo) populate(typ reflect.Type) error {
 	return nil
 }
 
-func interfaceSizer(v reflect.Value) (int, error) {
+func rawValueSizer(v reflect.Value, _ *sizeCache) (int, error) {
+	return v.Len(), nil
+}
+
+func rawValueWriter(v reflect.Value, w *encBuffer) error {
+	w.str = append(w.str, v.Bytes()...)
+	return nil
+}
+
+func interfaceSizer(v reflect.Value, c *sizeCache) (int, error) {
 	if v.IsNil() {
 		return 1, nil
 	}
 
 	v1 := v.Elem()
 	info := getInfo(v1.Type())
-	return info.s(v1)
+	return info.s(v1, c)
 }
 
-func interfaceWriter(v reflect.Value, b []byte) []byte {
+func interfaceWriter(v reflect.Value, w *encBuffer) error {
 	if v.IsNil() {
-		return append(b, 0xc0)
+		w.str = append(w.str, 0xc0)
+		return nil
 	}
 
 	v1 := v.Elem()
 	info := getInfo(v1.Type())
-	return info.w(v1, b)
+	return info.w(v1, w)
 }
 
-func makePtrFuncs(typ reflect.Type) (sizer, writer) {
-	ei := getInfo(typ.Elem())
+// makePtrFuncs handles pointers, encoding nil as the empty string or the
+// empty list depending on nk.
+func makePtrFuncs(typ reflect.Type, nk nilKind) (sizer, writer) {
+	ei := getInfoLocked(typ.Elem())
 
-	return func(v reflect.Value) (int, error) {
-		if v.IsNil() {
-			return 1, nil
+	return func(v reflect.Value, c *sizeCache) (int, error) {
+		if ei.err != nil {
+			return 0, ei.err
 		}
 
-		return ei.s(v.Elem())
-	}, func(v reflect.Value, b []byte) []byte {
 		if v.IsNil() {
-			t1 := typ.Elem()
-			k1 := t1.Kind()
+			return 1, nil
+		}
 
-			if k1 == reflect.Array && isByte(t1.Elem()) {
-				return append(b, 0x80)
-			} else if k1 == reflect.Struct || k1 == reflect.Array {
-				return append(b, 0xc0)
-			}
+		return ei.s(v.Elem(), c)
+	}, func(v reflect.Value, w *encBuffer) error {
+		if ei.err != nil {
+			return ei.err
+		}
 
-			v1 := reflect.Zero(t1)
-			return getInfo(t1).w(v1, b)
+		if v.IsNil() {
+			w.str = append(w.str, byte(nk))
+			return nil
 		}
 
-		return ei.w(v.Elem(), b)
+		return ei.w(v.Elem(), w)
 	}
 }
 
-func bigIntNoPtrSizer(v reflect.Value) (int, error) {
+func bigIntNoPtrSizer(v reflect.Value, _ *sizeCache) (int, error) {
 	i := v.Interface().(big.Int)
 	return bigIntSizer(&i)
 }
 
-func bigIntPtrSizer(v reflect.Value) (int, error) {
+func bigIntPtrSizer(v reflect.Value, _ *sizeCache) (int, error) {
 	if v.IsNil() {
 		return 1, nil
 	}
@@ -207,55 +411,106 @@ func bigIntSizer(i *big.Int) (int, error) {
 	return byteHeaderSize + len(intAsBytes), nil
 }
 
-func bigIntNoPtrWriter(v reflect.Value, b []byte) []byte {
+func bigIntNoPtrWriter(v reflect.Value, w *encBuffer) error {
 	i := v.Interface().(big.Int)
-	return bigIntWriter(&i, b)
+	return w.writeBigInt(&i)
 }
 
-func bigIntPtrWriter(v reflect.Value, b []byte) []byte {
+func bigIntPtrWriter(v reflect.Value, w *encBuffer) error {
 	if v.IsNil() {
-		return append(b, 0x80)
+		w.str = append(w.str, 0x80)
+		return nil
 	}
 
 	v1 := v.Interface().(*big.Int)
-	return bigIntWriter(v1, b)
+	return w.writeBigInt(v1)
+}
+
+func uint256Sizer(v reflect.Value, _ *sizeCache) (int, error) {
+	z := uint256Value(v)
+	if z.IsUint64() {
+		return IntSize(z.Uint64()), nil
+	}
+
+	return 1 + z.ByteLen(), nil
 }
 
-func bigIntWriter(i *big.Int, b []byte) []byte {
-	vb := i.Bytes()
-	if len(vb) == 1 {
-		return encodeByte(b, vb[0])
+func uint256Writer(v reflect.Value, w *encBuffer) error {
+	z := uint256Value(v)
+	w.writeUint256(&z)
+	return nil
+}
+
+// uint256Value returns the u256.Uint256 in v. Values that aren't
+// addressable are read word by word, which unlike v.Interface doesn't
+// allocate.
+func uint256Value(v reflect.Value) u256.Uint256 {
+	if v.CanAddr() {
+		return *v.Addr().Interface().(*u256.Uint256)
 	}
 
-	return encodeBytes(b, vb)
+	var z u256.Uint256
+	for i := range z {
+		z[i] = v.Index(i).Uint()
+	}
+
+	return z
 }
 
-func nilSizer(_ reflect.Value) (int, error) {
+func nilSizer(reflect.Value, *sizeCache) (int, error) {
 	return 1, nil
 }
 
-func nilWriter(_ reflect.Value, b []byte) []byte {
-	return append(b, 0xc0)
+func nilWriter(_ reflect.Value, w *encBuffer) error {
+	w.str = append(w.str, 0xc0)
+	return nil
 }
 
+// makeEncoderFuncs handles types implementing Encoder, either directly or
+// through a pointer receiver. EncodeRLP writes straight into the output, and
+// the sizer runs it against a scratch buffer, so nothing is kept between
+// calls.
 func makeEncoderFuncs(typ reflect.Type) (sizer, writer) {
-	dataCache := map[reflect.Value][]byte{}
-	return func(v reflect.Value) (int, error) {
-		wz := newWriter(0)
-		// Can this be the pointer to avoid unnecessary copy?
-		if err := v.Interface().(Encoder).EncodeRLP(wz); err != nil {
+	var writer writer
+	if typ.Implements(encoderInterface) {
+		writer = func(v reflect.Value, w *encBuffer) error {
+			return v.Interface().(Encoder).EncodeRLP(w)
+		}
+	} else {
+		writer = func(v reflect.Value, w *encBuffer) error {
+			if !v.CanAddr() {
+				return fmt.Errorf("rlp: EncodeRLP of %v has a pointer receiver but the value is not addressable", v.Type())
+			}
+
+			return v.Addr().Interface().(Encoder).EncodeRLP(w)
+		}
+	}
+
+	return scratchFuncs(writer)
+}
+
+// scratchFuncs returns the funcs for values whose encoding can only be
+// found by writing it. The sizer runs writer against a scratch buffer. The
+// lists writer adds to the output weren't recorded by the sizer, which the
+// returned writer tells listStart.
+func scratchFuncs(writer writer) (sizer, writer) {
+	s := func(v reflect.Value, _ *sizeCache) (int, error) {
+		w := new(encBuffer)
+		if err := writer(v, w); err != nil {
 			return 0, err
 		}
 
-		dataCache[v] = wz.data
+		return w.size(), nil
+	}
 
-		return len(wz.data), nil
-	}, func(v reflect.Value, b []byte) []byte {
-		return append(b, dataCache[v]...)
+	return s, func(v reflect.Value, w *encBuffer) error {
+		w.opaque++
+		defer func() { w.opaque-- }()
+		return writer(v, w)
 	}
 }
 
-func stringSizer(v reflect.Value) (int, error) {
+func stringSizer(v reflect.Value, _ *sizeCache) (int, error) {
 	str := v.String()
 	byteHeaderSize, err := getStringHeaderSize(str)
 	if err != nil {
@@ -265,27 +520,18 @@ func stringSizer(v reflect.Value) (int, error) {
 	return byteHeaderSize + len(str), nil
 }
 
-func stringWriter(v reflect.Value, b []byte) []byte {
-	str := v.String()
-	if len(str) == 1 {
-		return encodeByte(b, str[0])
-	}
-
-	b = encodeByteHeader(b, len(str))
-	return append(b, str...)
+func stringWriter(v reflect.Value, w *encBuffer) error {
+	w.writeString(v.String())
+	return nil
 }
 
-func boolSizer(reflect.Value) (int, error) {
+func boolSizer(reflect.Value, *sizeCache) (int, error) {
 	return 1, nil
 }
 
-func boolWriter(v reflect.Value, b []byte) []byte {
-	val := v.Bool()
-	if val {
-		return append(b, 0x01)
-	}
-
-	return append(b, 0x80)
+func boolWriter(v reflect.Value, w *encBuffer) error {
+	w.writeBool(v.Bool())
+	return nil
 }
 
 func makeStructFuncs(typ reflect.Type) (sizer, writer, error) {
@@ -294,12 +540,13 @@ func makeStructFuncs(typ reflect.Type) (sizer, writer, error) {
 		return nil, nil, err
 	}
 
-	sizer := func(v reflect.Value) (int, error) {
+	payloadSizer := recordSizes(func(v reflect.Value, c *sizeCache) (int, error) {
 		siz := 0
-		for i := 0; i < len(fs); i++ {
+		n := encodedFieldCount(fs, v)
+		for i := 0; i < n; i++ {
 			f := v.Field(fs[i].idx)
 
-			fsiz, err := fs[i].ei.s(f)
+			fsiz, err := fs[i].ei.s(f, c)
 			if err != nil {
 				return 0, fmt.Errorf("error with %v: %v", fs[i].name, err)
 			}
@@ -307,37 +554,62 @@ func makeStructFuncs(typ reflect.Type) (sizer, writer, error) {
 			siz += fsiz
 		}
 
-		headerSize, err := getListHeaderSize(siz)
+		return siz, nil
+	})
+
+	return listSizer(payloadSizer), func(v reflect.Value, w *encBuffer) error {
+		lh, err := w.listStart(v, payloadSizer)
 		if err != nil {
-			return 0, err
+			return err
 		}
 
-		return siz + headerSize, nil
-	}
-
-	return sizer, func(v reflect.Value, b []byte) []byte {
-		siz, _ := sizer(v)
-
-		b = encodeListHeader(b, deriveListHeaderSize(siz))
-		for i := 0; i < len(fs); i++ {
+		n := encodedFieldCount(fs, v)
+		for i := 0; i < n; i++ {
 			f := v.Field(fs[i].idx)
 
-			b = fs[i].ei.w(f, b)
+			if err := fs[i].ei.w(f, w); err != nil {
+				return fmt.Errorf("error with %v: %v", fs[i].name, err)
+			}
+
+			if err := w.flushIfFull(); err != nil {
+				return err
+			}
 		}
 
-		return b
+		return w.listStop(lh)
 	},
 	nil
 }
 
 func makeSliceFuncs(typ reflect.Type) (sizer, writer) {
-	elemInfo := getInfo(typ.Elem())
+	elemsSizer, elemsWriter := makeTailFuncs(typ)
+	payloadSizer := recordSizes(elemsSizer)
+
+	return listSizer(payloadSizer), func(v reflect.Value, w *encBuffer) error {
+		lh, err := w.listStart(v, payloadSizer)
+		if err != nil {
+			return err
+		}
 
-	sizer := func(v reflect.Value) (int, error) {
+		if err := elemsWriter(v, w); err != nil {
+			return err
+		}
+
+		return w.listStop(lh)
+	}
+}
+
+// makeTailFuncs handles the elements of a slice or array without the list
+// around them. Slices use it for their payload, and rlp:"tail" fields for
+// adding their elements to the enclosing list.
+func makeTailFuncs(typ reflect.Type) (sizer, writer) {
+	elemInfo := getInfoLocked(typ.Elem())
+
+	return func(v reflect.Value, c *sizeCache) (int, error) {
 		siz := 0
 		for i:= 0; i < v.Len(); i++ {
 			v0 := v.Index(i)
-			siz0, err := elemInfo.s(v0)
+			siz0, err := elemInfo.s(v0, c)
 			if err != nil {
 				return 0, fmt.Errorf("failed to fetch size for index %d: %v", i, err)
 			}
@@ -345,50 +617,41 @@ func makeSliceFuncs(typ reflect.Type) (sizer, writer) {
 			siz += siz0
 		}
 
-		listHeaderSize, err := getListHeaderSize(siz)
-		if err != nil {
-			return 0, fmt.Errorf("failed to calculate list header size: %v", err)
+		return siz, nil
+	}, func(v reflect.Value, w *encBuffer) error {
+		for i := 0; i < v.Len(); i++ {
+			v0 := v.Index(i)
+			if err := elemInfo.w(v0, w); err != nil {
+				return fmt.Errorf("failed to encode index %d: %v", i, err)
+			}
+
+			if err := w.flushIfFull(); err != nil {
+				return err
+			}
 		}
 
-		return siz + listHeaderSize, nil
+		return nil
 	}
+}
 
-	return sizer, func(v reflect.Value, b []byte) []byte {
-		siz, _ := sizer(v)
+// listSizer turns a sizer for the payload of a list into one for the whole
+// list, header included.
+func listSizer(payload sizer) sizer {
+	return func(v reflect.Value, c *sizeCache) (int, error) {
+		siz, err := payload(v, c)
+		if err != nil {
+			return 0, err
+		}
 
-		b = encodeListHeader(b, deriveListHeaderSize(siz))
-		for i := 0; i < v.Len(); i++ {
-			v0 := v.Index(i)
-			b = elemInfo.w(v0, b)
+		headerSize, err := getListHeaderSize(siz)
+		if err != nil {
+			return 0, fmt.Errorf("failed to calculate list header size: %v", err)
 		}
 
-		return b
+		return siz + headerSize, nil
 	}
 }
 
-func deriveListHeaderSize(siz int) int {
-	switch {
-	case siz < 57:
-		return siz - 1
-	case siz < (1 << 8) + 2:
-		return siz - 2
-	case siz < (1 << 16) + 3:
-		return siz - 3
-	case siz < (1 << 24) + 4:
-		return siz - 4
-	case siz < (1 << 32) + 5:
-		return siz - 5
-	case siz < (1 << 40) + 6:
-		return siz - 6
-	case siz < (1 << 48) + 7:
-		return siz - 7
-	case siz < (1 << 56) + 8:
-		return siz - 8
-	}
-
-	panic("this shouldn't happen")
-}
-
 // Encoder ...
 type Encoder interface {
 	EncodeRLP(io.Writer) error
@@ -398,6 +661,7 @@ var (
 	encoderInterface = reflect.TypeOf(new(Encoder)).Elem()
 	bigInt           = reflect.TypeOf(big.Int{})
 	bigIntPtr        = reflect.PtrTo(bigInt)
+	uint256Type      = reflect.TypeOf(u256.Uint256{})
 )
 
 type tags struct {
@@ -409,19 +673,65 @@ type tags struct {
 	tail bool
 	// rlp:"-" ignores fields.
 	ignored bool
+	// rlp:"optional" allows the field to be missing at the end of the
+	// list. Zero-valued optional fields at the end are not encoded. Only
+	// optional and tail fields may follow an optional field.
+	optional bool
 }
 
 type fieldInfo struct {
 	name     string
 	idx      int
+	tags     tags
 	ei       *encodeInfo
 }
 
 func getFieldInfo(typ reflect.Type) ([]*fieldInfo, error) {
-	len := typ.NumField()
+	sfs, err := structFields(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := make([]*fieldInfo, 0, len(sfs))
+	for _, sf := range sfs {
+		ei := getInfoLocked(sf.typ)
+		if ei.err != nil {
+			return nil, ei.err
+		}
+
+		switch {
+		case sf.tags.tail:
+			// The elements go straight into the struct's list.
+			ei = &encodeInfo{typ: sf.typ}
+			ei.s, ei.w = makeTailFuncs(sf.typ)
+		case sf.tags.nilOK:
+			// A nil pointer is always the empty value, even for
+			// pointers implementing Encoder.
+			ei = &encodeInfo{typ: sf.typ}
+			ei.s, ei.w = makePtrFuncs(sf.typ, defaultNilKind(sf.typ.Elem()))
+		}
 
-	fs := make([]*fieldInfo, 0, len)
-	for i := 0; i < len; i++ {
+		f := &fieldInfo{name: sf.name, idx: sf.idx, tags: sf.tags, ei: ei}
+		fs = append(fs, f)
+	}
+
+	return fs, nil
+}
+
+// structField is a struct field that is part of the RLP list.
+type structField struct {
+	name string
+	idx  int
+	typ  reflect.Type
+	tags tags
+}
+
+// structFields selects the fields of typ that make up its RLP list, skipping
+// unexported fields and fields tagged rlp:"-". The encoder and the decoder
+// both use it so that they agree on the shape of the list.
+func structFields(typ reflect.Type) ([]structField, error) {
+	var fs []structField
+	for i := 0; i < typ.NumField(); i++ {
 		structF := typ.Field(i)
 
 		tags, err := parseStructTag(typ, i)
@@ -433,14 +743,35 @@ func getFieldInfo(typ reflect.Type) ([]*fieldInfo, error) {
 			continue
 		}
 
-		ei := getInfo(structF.Type)
-		f := &fieldInfo{name: structF.Name, idx: i, ei: ei}
-		fs = append(fs, f)
+		if n := len(fs); n > 0 && fs[n-1].tags.optional && !tags.optional && !tags.tail {
+			return nil, fmt.Errorf(`rlp: struct field %v.%s needs "optional" tag because it follows optional field %s`, typ, structF.Name, fs[n-1].name)
+		}
+
+		fs = append(fs, structField{name: structF.Name, idx: i, typ: structF.Type, tags: tags})
 	}
 
 	return fs, nil
 }
 
+// encodedFieldCount returns how many of fs are written for v. Trailing
+// optional fields holding zero values are left out, and so is a tail field
+// after them if it has no elements, whether it's nil or not.
+func encodedFieldCount(fs []*fieldInfo, v reflect.Value) int {
+	n := len(fs)
+	for n > 0 {
+		f := fs[n-1]
+		if f.tags.tail && v.Field(f.idx).Len() == 0 {
+			n--
+		} else if f.tags.optional && v.Field(f.idx).IsZero() {
+			n--
+		} else {
+			break
+		}
+	}
+
+	return n
+}
+
 func parseStructTag(typ reflect.Type, fi int) (tags, error) {
 	f := typ.Field(fi)
 	var ts tags
@@ -449,8 +780,13 @@ func parseStructTag(typ reflect.Type, fi int) (tags, error) {
 		case "":
 		case "-":
 			ts.ignored = true
+		case "optional":
+			ts.optional = true
 		case "nil":
 			ts.nilOK = true
+			if f.Type.Kind() != reflect.Ptr {
+				return ts, fmt.Errorf(`rlp: invalid struct tag "nil" for %v.%s (field is not a pointer)`, typ, f.Name)
+			}
 		case "tail":
 			ts.tail = true
 			if fi != typ.NumField()-1 {
@@ -466,6 +802,34 @@ func parseStructTag(typ reflect.Type, fi int) (tags, error) {
 	return ts, nil
 }
 
+// nilKind is the empty value a nil pointer stands for.
+type nilKind byte
+
+const (
+	nilString nilKind = 0x80
+	nilList   nilKind = 0xc0
+)
+
+// defaultNilKind returns the empty value matching the encoding of typ:
+// an empty list for structs, lists and interfaces, and an empty string
+// for everything else. Pointers take the kind of the type they point to.
+func defaultNilKind(typ reflect.Type) nilKind {
+	k := typ.Kind()
+	switch {
+	case typ == uint256Type:
+		return nilString
+	case k == reflect.Ptr:
+		return defaultNilKind(typ.Elem())
+	case (k == reflect.Slice || k == reflect.Array) && typ.Elem().Kind() == reflect.Uint8:
+		return nilString
+	case k == reflect.Struct && !typ.AssignableTo(bigInt):
+		return nilList
+	case k == reflect.Slice || k == reflect.Array || k == reflect.Interface:
+		return nilList
+	}
+
+	return nilString
+}
 
 func getListHeaderSize(size int) (int, error) {
 	if size < 56 {
@@ -512,73 +876,42 @@ func getBigEndianSize(num uint) int {
 	return int(i)
 }
 
-func byteArraySizer(v reflect.Value) (int, error) {
-	len := v.Len()
-	if len == 0 && v.Index(0).Interface().(byte) <= 0x7f {
-		return 1, nil
-	} else if len < 56 {
-		return 1+len, nil
-	} else if encodedSize := getBigEndianSize(uint(len)); encodedSize > 9 {
-		return 0, fmt.Errorf("encoding size limit exceeded: %d bytes long", len)
-	} else {
-		return 1+encodedSize+len, nil
+func byteArraySizer(v reflect.Value, _ *sizeCache) (int, error) {
+	if v.Len() == 1 {
+		return BytesSize([]byte{byte(v.Index(0).Uint())}), nil
 	}
+
+	return stringSize(v.Len()), nil
 }
 
-func byteArrayWriter(v reflect.Value, b []byte) []byte {
+func byteArrayWriter(v reflect.Value, w *encBuffer) error {
 	if !v.CanAddr() {
-		// Slice requires the value to be addressable.
+		// Bytes requires the value to be addressable.
 		// Make it addressable by copying.
 		copy := reflect.New(v.Type()).Elem()
 		copy.Set(v)
 		v = copy
 	}
-	size := v.Len()
-	slice := v.Slice(0, size).Bytes()
-	return encodeBytes(b, slice)
+	w.writeBytes(v.Bytes())
+	return nil
 }
 
-func byteSliceSizer(v reflect.Value) (int, error) {
-	// TODO: Calculate without converting to bytes
-	bytes := v.Bytes()
-
-	size, err := getByteHeaderSize(bytes)
-	if err != nil {
-		return 0, err
-	}
-
-	return size + len(bytes), nil
+func byteSliceSizer(v reflect.Value, _ *sizeCache) (int, error) {
+	return BytesSize(v.Bytes()), nil
 }
 
-func byteSliceWriter(v reflect.Value, b []byte) []byte {
-	bytes := v.Bytes()
-
-	if len(bytes) == 1 {
-		return encodeByte(b, bytes[0])
-	}
-
-	return encodeBytes(b, bytes)
+func byteSliceWriter(v reflect.Value, w *encBuffer) error {
+	w.writeBytes(v.Bytes())
+	return nil
 }
 
-func uintSizer(v reflect.Value) (int, error) {
-	v1 := v.Uint()
-
-	if v1 < 128 {
-		return 1, nil
-	}
-
-	return getBigEndianSize(uint(v1)) + 1, nil
+func uintSizer(v reflect.Value, _ *sizeCache) (int, error) {
+	return IntSize(v.Uint()), nil
 }
 
-func uintWriter(v reflect.Value, b []byte) []byte {
-	v1 := v.Uint()
-	if v1 == 0 {
-		return append(b, 0x80)
-	} else if v1 < 128 {
-		return encodeByte(b, byte(v1))
-	}
-
-	return encodeBytes(b, convertBigEndian(uint(v1)))
+func uintWriter(v reflect.Value, w *encBuffer) error {
+	w.writeUint64(v.Uint())
+	return nil
 }
 
 func encodeByte(bs []byte, b byte) []byte {
@@ -599,10 +932,8 @@ func encodeListHeader(bs []byte, size int) []byte {
 		return append(bs, 0xc0+byte(size))
 	}
 
-	byteHeader := convertBigEndian(uint(size))
-	bs = append(bs, 0xf7+byte(len(byteHeader)))
-
-	return append(bs, byteHeader...)
+	bs = append(bs, 0xf7+byte(getBigEndianSize(uint(size))))
+	return appendBigEndian(bs, uint(size))
 }
 
 func encodeByteHeader(bs []byte, size int) []byte {
@@ -610,26 +941,31 @@ func encodeByteHeader(bs []byte, size int) []byte {
 		return append(bs, 0x80+byte(size))
 	}
 
-	byteHeader := convertBigEndian(uint(size))
-	bs = append(bs, 0xb7+byte(len(byteHeader)))
-	return append(bs, byteHeader...)
+	bs = append(bs, 0xb7+byte(getBigEndianSize(uint(size))))
+	return appendBigEndian(bs, uint(size))
 }
 
-var data = make([]byte, 8)
-
-func convertBigEndian(num uint) []byte {
-	var i int
-	for i = 7; num >= 1; i, num = i-1, num >> 8 {
-		data[i] = byte(num)
+// appendBigEndian appends num to b in big-endian order, without leading
+// zero bytes.
+func appendBigEndian(b []byte, num uint) []byte {
+	for i := getBigEndianSize(num) - 1; i >= 0; i-- {
+		b = append(b, byte(num>>uint(8*i)))
 	}
 
-	return data[i+1:]
+	return b
 }
 
 func isUint(k reflect.Kind) bool {
 	return k >= reflect.Uint && k <= reflect.Uintptr
 }
 
+// isByte reports whether slices and arrays of typ encode as strings. Byte
+// types with their own encoding, through EncodeRLP on the value or its
+// pointer or through Register, make them lists instead. It must be called
+// with infoMu held.
 func isByte(typ reflect.Type) bool {
-	return typ.Kind() == reflect.Uint8 && !typ.Implements(encoderInterface)
+	return typ.Kind() == reflect.Uint8 &&
+		!typ.Implements(encoderInterface) &&
+		!reflect.PtrTo(typ).Implements(encoderInterface) &&
+		encodeFuncs[typ] == nil
 }
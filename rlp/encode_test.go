@@ -7,6 +7,14 @@ import (
 	"strings"
 	"encoding/hex"
 	"math/big"
+	"reflect"
+	"sync"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing/iotest"
+
+	"github.com/rawfalafel/ethereum-toolbox/u256"
 	// rlp2 "github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -42,19 +50,39 @@ type recstruct struct {
 	Child *recstruct `rlp:"nil"`
 }
 
-type RawValue []byte
-
 type tailRaw struct {
 	A    uint
 	Tail []RawValue `rlp:"tail"`
 }
 
+type nilEncoderField struct {
+	E *testEncoder `rlp:"nil"`
+	B *[]byte      `rlp:"nil"`
+}
+
 type hasIgnoredField struct {
 	A uint
 	B uint `rlp:"-"`
 	C uint
 }
 
+type optionalFields struct {
+	A uint
+	B uint `rlp:"optional"`
+	C uint `rlp:"optional"`
+}
+
+type optionalPtrField struct {
+	A uint
+	B *big.Int `rlp:"optional"`
+}
+
+type optionalAndTail struct {
+	A    uint
+	B    uint   `rlp:"optional"`
+	Tail []uint `rlp:"tail"`
+}
+
 var encTests = []encTest{
 	// booleans
 	{val: true, output: "01"},
@@ -99,6 +127,19 @@ var encTests = []encTest{
 		output: "A1010000000000000000000000000000000000000000000000000000000000000000",
 	},
 
+	// 256-bit integers
+	{val: u256.Uint256{}, output: "80"},
+	{val: u256.NewUint256(127), output: "7F"},
+	{val: u256.NewUint256(128), output: "8180"},
+	{val: u256.NewUint256(0xFFFFFFFFFFFFFFFF), output: "88FFFFFFFFFFFFFFFF"},
+	{val: u256.Uint256{0, 1}, output: "89010000000000000000"},
+	{
+		val:    u256.Uint256{^uint64(0), ^uint64(0), ^uint64(0), ^uint64(0)},
+		output: "A0FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+	},
+	{val: (*u256.Uint256)(nil), output: "80"},
+	{val: []u256.Uint256{{1}, {0, 0, 1}}, output: "D301910100000000000000000000000000000000"},
+
 	// non-pointer big.Int
 	{val: *big.NewInt(0), output: "80"},
 	{val: *big.NewInt(0xFFFFFF), output: "83FFFFFF"},
@@ -189,22 +230,38 @@ var encTests = []encTest{
 	},
 
 	// RawValue
-	//{val: RawValue(unhex("01")), output: "01"},
-	//{val: RawValue(unhex("82FFFF")), output: "82FFFF"},
-	//{val: []RawValue{unhex("01"), unhex("02")}, output: "C20102"},
+	{val: RawValue(unhex("01")), output: "01"},
+	{val: RawValue(unhex("82FFFF")), output: "82FFFF"},
+	{val: []RawValue{unhex("01"), unhex("02")}, output: "C20102"},
+	{val: &struct{ A, B RawValue }{unhex("C20102"), unhex("83616263")}, output: "C7C2010283616263"},
 
 	// structs
 	{val: simplestruct{}, output: "C28080"},
 	{val: simplestruct{A: 3, B: "foo"}, output: "C50383666F6F"},
 	{val: &recstruct{5, nil}, output: "C205C0"},
 	{val: &recstruct{5, &recstruct{4, &recstruct{3, nil}}}, output: "C605C404C203C0"},
-	// {val: &tailRaw{A: 1, Tail: []RawValue{unhex("02"), unhex("03")}}, output: "C3010203"},
-	// {val: &tailRaw{A: 1, Tail: []RawValue{unhex("02")}}, output: "C20102"},
-	// {val: &tailRaw{A: 1, Tail: []RawValue{}}, output: "C101"},
-	// {val: &tailRaw{A: 1, Tail: nil}, output: "C101"},
+	{val: &tailRaw{A: 1, Tail: []RawValue{unhex("02"), unhex("03")}}, output: "C3010203"},
+	{val: &tailRaw{A: 1, Tail: []RawValue{unhex("02")}}, output: "C20102"},
+	{val: &tailRaw{A: 1, Tail: []RawValue{}}, output: "C101"},
+	{val: &tailRaw{A: 1, Tail: nil}, output: "C101"},
+	{val: &tailUints{A: 1, Tail: []uint{2, 300}}, output: "C5010282012C"},
+	{val: &optionalAndTail{A: 1, Tail: []uint{3}}, output: "C3018003"},
+	{val: &optionalAndTail{A: 1}, output: "C101"},
 	{val: &hasIgnoredField{A: 1, B: 2, C: 3}, output: "C20103"},
 
+	// optional fields
+	{val: &optionalFields{A: 1}, output: "C101"},
+	{val: &optionalFields{A: 1, B: 2}, output: "C20102"},
+	{val: &optionalFields{A: 1, C: 3}, output: "C3018003"},
+	{val: &optionalFields{A: 1, B: 2, C: 3}, output: "C3010203"},
+	{val: &optionalPtrField{A: 1}, output: "C101"},
+	{val: &optionalPtrField{A: 1, B: big.NewInt(0)}, output: "C20180"},
+	{val: &optionalPtrField{A: 1, B: big.NewInt(2)}, output: "C20102"},
+
 	// nil
+	{val: &recstruct{I: 1}, output: "C201C0"},
+	{val: &nilEncoderField{}, output: "C2C080"},
+	{val: &nilEncoderField{E: &testEncoder{}, B: &[]byte{1}}, output: "CB0001000100010001000101"},
 	{val: (*uint)(nil), output: "80"},
 	{val: (*string)(nil), output: "80"},
 	{val: (*[]byte)(nil), output: "80"},
@@ -216,22 +273,111 @@ var encTests = []encTest{
 	{val: (*[]struct{ uint })(nil), output: "C0"},
 	{val: (interface{})(nil), output: "C0"},
 	{val: (*interface{})(nil), output: "C0"},
+	{val: (**recstruct)(nil), output: "C0"},
+	{val: (**[]byte)(nil), output: "80"},
+	{val: (**uint)(nil), output: "80"},
+	{val: &struct{ P *[]string }{P: nil}, output: "C1C0"},
 
 	// interfaces
 	// {val: []io.Reader{reader}, output: "C3C20102"}, // the contained value is a struct
 
 	// Encoder
-	//{val: (*testEncoder)(nil), output: "00000000"},
-	//{val: &testEncoder{}, output: "00010001000100010001"},
-	//{val: &testEncoder{errors.New("test error")}, error: "test error"},
+	{val: (*testEncoder)(nil), output: "00000000"},
+	{val: &testEncoder{}, output: "00010001000100010001"},
+	{val: &testEncoder{errors.New("test error")}, error: "test error"},
 	// verify that pointer method testEncoder.EncodeRLP is called for
 	// addressable non-pointer values.
-	//{val: &struct{ TE testEncoder }{testEncoder{}}, output: "CA00010001000100010001"},
-	//{val: &struct{ TE testEncoder }{testEncoder{errors.New("test error")}}, error: "test error"},
+	{val: &struct{ TE testEncoder }{testEncoder{}}, output: "CA00010001000100010001"},
+	{val: &struct{ TE testEncoder }{testEncoder{errors.New("test error")}}, error: "error with TE: test error"},
+	{val: []testEncoder{{}, {}}, output: "D40001000100010001000100010001000100010001"},
 	// verify the error for non-addressable non-pointer Encoder
-	//{val: testEncoder{}, error: "rlp: game over: unadressable value of type rlp.testEncoder, EncodeRLP is pointer method"},
+	{val: testEncoder{}, error: "rlp: EncodeRLP of rlp.testEncoder has a pointer receiver but the value is not addressable"},
 	// verify the special case for []byte
-	//{val: []byteEncoder{0, 1, 2, 3, 4}, output: "C5C0C0C0C0C0"},
+	{val: []byteEncoder{0, 1, 2, 3, 4}, output: "C5C0C0C0C0C0"},
+	{val: []ptrByteEncoder{1, 2}, output: "C20203"},
+}
+
+type testEncoder struct {
+	err error
+}
+
+func (e *testEncoder) EncodeRLP(w io.Writer) error {
+	if e == nil {
+		w.Write([]byte{0, 0, 0, 0})
+	} else if e.err != nil {
+		return e.err
+	} else {
+		w.Write([]byte{0, 1, 0, 1, 0, 1, 0, 1, 0, 1})
+	}
+	return nil
+}
+
+type byteEncoder byte
+
+func (e byteEncoder) EncodeRLP(w io.Writer) error {
+	w.Write([]byte{0xc0})
+	return nil
+}
+
+// ptrByteEncoder is a byte type with pointer receiver methods. It encodes as
+// its value plus one.
+type ptrByteEncoder byte
+
+func (e *ptrByteEncoder) EncodeRLP(w io.Writer) error {
+	return Encode(w, uint(*e)+1)
+}
+
+func (e *ptrByteEncoder) DecodeRLP(s *Stream) error {
+	n, err := s.Uint64()
+	*e = ptrByteEncoder(n - 1)
+	return err
+}
+
+func TestPtrByteEncoderRoundTrip(t *testing.T) {
+	in := []ptrByteEncoder{0, 1, 2}
+	enc, err := EncodeToBytes(in)
+	if err != nil {
+		t.Fatalf("error encoding: %v", err)
+	}
+
+	if !bytes.Equal(enc, unhex("C3010203")) {
+		t.Errorf("unexpected encoding: %X", enc)
+	}
+
+	var out []ptrByteEncoder
+	if err := DecodeBytes(enc, &out); err != nil {
+		t.Fatalf("error decoding: %v", err)
+	}
+
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip mismatch: got %v, want %v", out, in)
+	}
+}
+
+// equalEncoder values compare equal as reflect.Values but encode
+// differently, which used to trip up the Encoder cache.
+type equalEncoder struct {
+	n *uint
+}
+
+func (e equalEncoder) EncodeRLP(w io.Writer) error {
+	return Encode(w, *e.n)
+}
+
+func TestEncoderNoRetainedState(t *testing.T) {
+	n := uint(1)
+	e := equalEncoder{&n}
+	for _, want := range []uint{1, 2, 300} {
+		n = want
+		b, err := EncodeToBytes([]equalEncoder{e})
+		if err != nil {
+			t.Fatalf("EncodeToBytes(%d): %v", want, err)
+		}
+		wantb, _ := EncodeToBytes([]uint{want})
+		if !bytes.Equal(b, wantb) {
+			t.Errorf("n = %d: got %X, want %X", want, b, wantb)
+		}
+	}
 }
 
 func runEncTests(t *testing.T, f func(val interface{}) ([]byte, error)) {
@@ -261,6 +407,420 @@ func TestEncode(t *testing.T) {
 	})
 }
 
+func TestEncodeToWriter(t *testing.T) {
+	runEncTests(t, func(val interface{}) ([]byte, error) {
+		buf := new(bytes.Buffer)
+		err := Encode(buf, val)
+		return buf.Bytes(), err
+	})
+}
+
+func TestEncodeToReader(t *testing.T) {
+	runEncTests(t, func(val interface{}) ([]byte, error) {
+		_, r, err := EncodeToReader(val)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(r)
+	})
+}
+
+func TestAppendToBytes(t *testing.T) {
+	prefix := []byte{0xde, 0xad}
+	runEncTests(t, func(val interface{}) ([]byte, error) {
+		b, err := AppendToBytes(append([]byte{}, prefix...), val)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasPrefix(b, prefix) {
+			t.Errorf("prefix lost: %X", b)
+		}
+		return b[len(prefix):], nil
+	})
+}
+
+func TestEncoderBuffer(t *testing.T) {
+	w := NewEncoderBuffer(nil)
+	runEncTests(t, func(val interface{}) ([]byte, error) {
+		w.Reset(nil)
+		if err := w.Encode(val); err != nil {
+			return nil, err
+		}
+		return w.ToBytes(), nil
+	})
+
+	// Several values go out back to back.
+	out := new(bytes.Buffer)
+	w.Reset(out)
+	txs := makeBenchTxs(100)
+	for _, tx := range txs {
+		if err := w.Encode(&tx); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	var want []byte
+	for _, tx := range txs {
+		want, _ = AppendToBytes(want, &tx)
+	}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("output mismatch")
+	}
+}
+
+func TestEncoderBufferBuilder(t *testing.T) {
+	type inner struct {
+		A string
+		B []uint
+	}
+	type outer struct {
+		Flag  bool
+		N     uint64
+		Big   *big.Int
+		Data  []byte
+		Inner inner
+		List  []string
+	}
+	val := outer{
+		Flag:  true,
+		N:     1024,
+		Big:   new(big.Int).Lsh(big.NewInt(1), 100),
+		Data:  []byte{0x7f},
+		Inner: inner{A: "dog", B: []uint{0, 1, 300}},
+		List:  []string{strings.Repeat("a", 40), strings.Repeat("b", 40)},
+	}
+	want, err := EncodeToBytes(val)
+	if err != nil {
+		t.Fatalf("EncodeToBytes failed: %v", err)
+	}
+
+	w := NewEncoderBuffer(nil)
+	l := w.List()
+	w.WriteBool(val.Flag)
+	w.WriteUint64(val.N)
+	if err := w.WriteBigInt(val.Big); err != nil {
+		t.Fatalf("WriteBigInt failed: %v", err)
+	}
+	w.WriteBytes(val.Data)
+	l1 := w.List()
+	w.WriteString(val.Inner.A)
+	l2 := w.List()
+	for _, b := range val.Inner.B {
+		w.WriteUint64(uint64(b))
+	}
+	w.ListEnd(l2)
+	w.ListEnd(l1)
+	l1 = w.List()
+	for _, s := range val.List {
+		w.WriteString(s)
+	}
+	w.ListEnd(l1)
+	w.ListEnd(l)
+
+	if got := w.ToBytes(); !bytes.Equal(got, want) {
+		t.Errorf("output mismatch:\ngot  %X\nwant %X", got, want)
+	}
+
+	if err := w.WriteBigInt(big.NewInt(-1)); err == nil {
+		t.Errorf("WriteBigInt accepted a negative number")
+	}
+}
+
+// builderEncoder encodes itself through an EncoderBuffer.
+type builderEncoder struct {
+	A uint64
+	B []string
+}
+
+func (e *builderEncoder) EncodeRLP(_w io.Writer) error {
+	w := NewEncoderBuffer(_w)
+	l := w.List()
+	w.WriteUint64(e.A)
+	l1 := w.List()
+	for _, s := range e.B {
+		w.WriteString(s)
+	}
+	w.ListEnd(l1)
+	w.ListEnd(l)
+	return w.Flush()
+}
+
+func TestEncoderBufferInEncoder(t *testing.T) {
+	val := struct {
+		X uint
+		E *builderEncoder
+		Y string
+	}{1, &builderEncoder{A: 1024, B: []string{"cat", "dog"}}, "end"}
+	want := unhex("D201CC820400C88363617483646F6783656E64")
+
+	got, err := EncodeToBytes(&val)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("EncodeToBytes: got (%X, %v), want %X", got, err, want)
+	}
+
+	out := new(bytes.Buffer)
+	if err := Encode(out, &val); err != nil || !bytes.Equal(out.Bytes(), want) {
+		t.Fatalf("Encode: got (%X, %v), want %X", out.Bytes(), err, want)
+	}
+
+	// The inner EncoderBuffer shares the caller's buffer instead of
+	// allocating its own.
+	w := NewEncoderBuffer(nil)
+	if inner := NewEncoderBuffer(w); inner.buf != w.buf {
+		t.Errorf("EncoderBuffer writing to an EncoderBuffer has its own buffer")
+	}
+	if inner := NewEncoderBuffer(w.buf); inner.buf != w.buf {
+		t.Errorf("EncoderBuffer writing to an encBuffer has its own buffer")
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+	for i, test := range encTests {
+		if test.error != "" {
+			continue
+		}
+		size, err := EncodedSize(test.val)
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if want := len(unhex(test.output)); size != want {
+			t.Errorf("test %d: got size %d, want %d\nvalue %#v", i, size, want, test.val)
+		}
+	}
+}
+
+type sizeFuzzInner struct {
+	S string
+	B [3]byte
+	C [1]byte
+}
+
+type sizeFuzzStruct struct {
+	U       uint64
+	Big     *big.Int
+	Bytes   []byte
+	Flag    bool
+	Inner   sizeFuzzInner
+	Strings []string
+	Ptr     *sizeFuzzInner
+	Raw     RawValue
+	Any     interface{}
+	Opt     uint64 `rlp:"optional"`
+}
+
+func FuzzEncodedSize(f *testing.F) {
+	f.Add(uint64(0), []byte{}, "", false, []byte{0xc0})
+	f.Add(uint64(127), []byte{0x7f}, "a", true, []byte{0x80})
+	f.Add(uint64(1024), bytes.Repeat([]byte{0xff}, 60), strings.Repeat("x", 56), true, unhex("C6827A77C10401"))
+
+	f.Fuzz(func(t *testing.T, u uint64, b []byte, s string, flag bool, raw []byte) {
+		var any interface{}
+		if DecodeBytes(raw, &any) != nil {
+			raw = nil
+		}
+
+		val := &sizeFuzzStruct{
+			U:       u,
+			Big:     new(big.Int).SetBytes(b),
+			Bytes:   b,
+			Flag:    flag,
+			Inner:   sizeFuzzInner{S: s},
+			Strings: []string{s, string(b), s + s},
+			Raw:     raw,
+			Any:     any,
+		}
+		copy(val.Inner.B[:], b)
+		if len(b) > 0 {
+			val.Inner.C[0] = b[0]
+			val.Ptr = &val.Inner
+		}
+		if flag {
+			val.Opt = u
+		}
+
+		enc, err := EncodeToBytes(val)
+		if err != nil {
+			t.Fatalf("EncodeToBytes failed: %v", err)
+		}
+		size, err := EncodedSize(val)
+		if err != nil {
+			t.Fatalf("EncodedSize failed: %v", err)
+		}
+		if size != len(enc) {
+			t.Fatalf("EncodedSize = %d, encoding is %d bytes", size, len(enc))
+		}
+
+		intEnc, _ := EncodeToBytes(u)
+		if IntSize(u) != len(intEnc) {
+			t.Fatalf("IntSize(%d) = %d, encoding is %d bytes", u, IntSize(u), len(intEnc))
+		}
+		bytesEnc, _ := EncodeToBytes(b)
+		if BytesSize(b) != len(bytesEnc) {
+			t.Fatalf("BytesSize = %d, encoding is %d bytes", BytesSize(b), len(bytesEnc))
+		}
+		listEnc, _ := EncodeToBytes([][]byte{b, b})
+		if ListSize(2*len(bytesEnc)) != len(listEnc) {
+			t.Fatalf("ListSize = %d, encoding is %d bytes", ListSize(2*len(bytesEnc)), len(listEnc))
+		}
+	})
+}
+
+// writeRecorder remembers the largest write it has seen.
+type writeRecorder struct {
+	bytes.Buffer
+	maxWrite int
+}
+
+func (w *writeRecorder) Write(b []byte) (int, error) {
+	if len(b) > w.maxWrite {
+		w.maxWrite = len(b)
+	}
+	return w.Buffer.Write(b)
+}
+
+// nodeEncoder encodes a node through an EncoderBuffer sharing the output,
+// so the lists inside it are written without having been sized.
+type nodeEncoder struct {
+	N *benchNode
+}
+
+func (e *nodeEncoder) EncodeRLP(_w io.Writer) error {
+	w := NewEncoderBuffer(_w)
+	if err := w.Encode(e.N); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func TestEncodeStreaming(t *testing.T) {
+	shared := makeBenchTree(6)
+	vals := []interface{}{
+		makeBenchTxs(1000),
+		makeBenchTree(10),
+		[][]benchTx{makeBenchTxs(100), makeBenchTxs(10), makeBenchTxs(200)},
+		makeBenchChain(300),
+		// Not addressable, so the outer lists aren't recorded.
+		*makeBenchChain(200),
+		[]interface{}{[]interface{}{makeBenchTxs(100), *makeBenchChain(150)}, "end"},
+		&benchNode{Children: []*benchNode{shared, makeBenchTree(7), shared}},
+		[]interface{}{makeBenchChain(150), &nodeEncoder{makeBenchChain(150)}, makeBenchChain(150)},
+	}
+
+	for i, val := range vals {
+		want, err := EncodeToBytes(val)
+		if err != nil {
+			t.Fatalf("test %d: EncodeToBytes failed: %v", i, err)
+		}
+
+		w := new(writeRecorder)
+		if err := Encode(w, val); err != nil {
+			t.Fatalf("test %d: Encode failed: %v", i, err)
+		}
+		if !bytes.Equal(w.Bytes(), want) {
+			t.Errorf("test %d: output mismatch", i)
+		}
+		// Each element is small, so no write should be much larger
+		// than a chunk.
+		if w.maxWrite > 2*writeChunk {
+			t.Errorf("test %d: wrote %d bytes at once, output is %d bytes", i, w.maxWrite, len(want))
+		}
+
+		size, r, err := EncodeToReader(val)
+		if err != nil {
+			t.Fatalf("test %d: EncodeToReader failed: %v", i, err)
+		}
+		got, err := ioutil.ReadAll(iotest.OneByteReader(r))
+		if err != nil {
+			t.Fatalf("test %d: read failed: %v", i, err)
+		}
+		if size != len(want) || !bytes.Equal(got, want) {
+			t.Errorf("test %d: reader output mismatch, size %d", i, size)
+		}
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestEncodeWriteError(t *testing.T) {
+	err := Encode(failWriter{}, makeBenchTxs(100))
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("got error %v, want write error", err)
+	}
+}
+
+type parallelInner struct {
+	A uint64
+	B []byte
+	C *big.Int
+}
+
+type parallelOuter struct {
+	Items []parallelInner
+	Name  string
+	Raw   RawValue
+	Opt   uint32 `rlp:"optional"`
+}
+
+// TestParallelEncodeDecode builds the type caches from several goroutines at
+// once and then keeps encoding and decoding. Run it with -race.
+func TestParallelEncodeDecode(t *testing.T) {
+	const goroutines = 16
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				in := parallelOuter{
+					Items: []parallelInner{{A: uint64(g) << 40, B: []byte{byte(i)}, C: big.NewInt(int64(i) << 20)}},
+					Name:  fmt.Sprintf("goroutine %d", g),
+					Raw:   unhex("C20102"),
+					Opt:   uint32(i) << 12,
+				}
+
+				dat, err := EncodeToBytes(&in)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				out := new(parallelOuter)
+				if err := DecodeBytes(dat, out); err != nil {
+					errs <- err
+					return
+				}
+
+				if !reflect.DeepEqual(in, *out) {
+					errs <- fmt.Errorf("round trip mismatch: %+v != %+v", in, *out)
+					return
+				}
+
+				var generic interface{}
+				if err := DecodeBytes(dat, &generic); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(g)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
 func unhex(str string) []byte {
 	r := strings.NewReplacer("\t", "", " ", "", "\n", "")
 	b, err := hex.DecodeString(r.Replace(str))
@@ -285,3 +845,166 @@ func BenchmarkEncodeStruct(b *testing.B) {
 		}
 	}
 }
+
+type benchTx struct {
+	Nonce    uint64
+	GasPrice *big.Int
+	To       [20]byte
+	Value    *big.Int
+	Data     []byte
+}
+
+func makeBenchTxs(n int) []benchTx {
+	txs := make([]benchTx, n)
+	for i := range txs {
+		txs[i] = benchTx{
+			Nonce:    uint64(i),
+			GasPrice: big.NewInt(20000000000),
+			Value:    new(big.Int).Lsh(big.NewInt(int64(i)), 64),
+			Data:     bytes.Repeat([]byte{byte(i)}, 100),
+		}
+	}
+	return txs
+}
+
+// benchNode is a deeply nested value, where sizing every level before
+// writing it is most expensive.
+type benchNode struct {
+	Data     []byte
+	Children []*benchNode
+}
+
+func makeBenchTree(depth int) *benchNode {
+	n := &benchNode{Data: bytes.Repeat([]byte{byte(depth)}, 32)}
+	if depth > 0 {
+		n.Children = []*benchNode{makeBenchTree(depth - 1), makeBenchTree(depth - 1)}
+	}
+	return n
+}
+
+func BenchmarkEncodeTxs(b *testing.B) {
+	txs := makeBenchTxs(1000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := EncodeToBytes(txs); err != nil {
+			b.Fatalf("failed EncodeToBytes: %v", err)
+		}
+	}
+}
+
+func BenchmarkAppendToBytes(b *testing.B) {
+	txs := makeBenchTxs(1000)
+	var buf []byte
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = AppendToBytes(buf[:0], txs); err != nil {
+			b.Fatalf("failed AppendToBytes: %v", err)
+		}
+	}
+}
+
+func BenchmarkEncoderBuffer(b *testing.B) {
+	txs := makeBenchTxs(1000)
+	w := NewEncoderBuffer(ioutil.Discard)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range txs {
+			if err := w.Encode(&txs[j]); err != nil {
+				b.Fatalf("failed Encode: %v", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			b.Fatalf("failed Flush: %v", err)
+		}
+	}
+}
+
+func BenchmarkEncodeDeepTree(b *testing.B) {
+	tree := makeBenchTree(12)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := EncodeToBytes(tree); err != nil {
+			b.Fatalf("failed EncodeToBytes: %v", err)
+		}
+	}
+}
+
+// makeBenchChain returns a list of lists, depth levels deep, in which all
+// but the innermost levels are larger than a write chunk.
+func makeBenchChain(depth int) *benchNode {
+	n := &benchNode{Data: bytes.Repeat([]byte{0}, 32)}
+	for i := 1; i <= depth; i++ {
+		n = &benchNode{Data: bytes.Repeat([]byte{byte(i)}, 32), Children: []*benchNode{n}}
+	}
+	return n
+}
+
+// BenchmarkEncodeNested compares streaming to a writer with encoding to
+// bytes on values with many levels of large lists.
+func BenchmarkEncodeNested(b *testing.B) {
+	vals := []struct {
+		name string
+		val  *benchNode
+	}{
+		{"chain-200", makeBenchChain(200)},
+		{"chain-2000", makeBenchChain(2000)},
+		{"tree-14", makeBenchTree(14)},
+	}
+
+	for _, v := range vals {
+		b.Run(v.name+"/EncodeToBytes", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := EncodeToBytes(v.val); err != nil {
+					b.Fatalf("failed EncodeToBytes: %v", err)
+				}
+			}
+		})
+		b.Run(v.name+"/Encode", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := Encode(ioutil.Discard, v.val); err != nil {
+					b.Fatalf("failed Encode: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEncodeBigInts(b *testing.B) {
+	vals := make([]*big.Int, 1000)
+	for i := range vals {
+		vals[i] = new(big.Int).Lsh(big.NewInt(int64(i)), 128)
+	}
+	benchmarkAppend(b, vals)
+}
+
+func BenchmarkEncodeUint256s(b *testing.B) {
+	vals := make([]u256.Uint256, 1000)
+	for i := range vals {
+		vals[i] = u256.Uint256{0, 0, uint64(i)}
+	}
+	benchmarkAppend(b, vals)
+}
+
+func benchmarkAppend(b *testing.B, val interface{}) {
+	var buf []byte
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = AppendToBytes(buf[:0], val); err != nil {
+			b.Fatalf("failed AppendToBytes: %v", err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package rlp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	// ErrExpectedString is returned when a list is found where a string
+	// was expected.
+	ErrExpectedString = errors.New("rlp: expected string or byte")
+	// ErrExpectedList is returned when a string is found where a list was
+	// expected.
+	ErrExpectedList = errors.New("rlp: expected list")
+	// ErrCanonSingleByte is returned for a single byte below 0x80 that is
+	// wrapped in a string header instead of being encoded as itself.
+	ErrCanonSingleByte = errors.New("rlp: non-canonical single byte")
+	// ErrCanonSize is returned for a long-form header whose payload would
+	// fit a short header, or whose size has leading zero bytes.
+	ErrCanonSize = errors.New("rlp: non-canonical size information")
+	// ErrCanonInt is returned for an integer with leading zero bytes.
+	ErrCanonInt = errors.New("rlp: non-canonical integer (leading zero bytes)")
+	// ErrValueTooLarge is returned for an integer that doesn't fit the
+	// type it's decoded into.
+	ErrValueTooLarge = errors.New("rlp: value too large for target type")
+	// ErrElemTooLarge is returned for an item that extends past the end
+	// of the list containing it.
+	ErrElemTooLarge = errors.New("rlp: element is larger than containing list")
+	// ErrTooFewElements is returned when a list ends before every struct
+	// field or array element has been decoded.
+	ErrTooFewElements = errors.New("rlp: too few elements in list")
+	// ErrTooManyElements is returned when a list has elements left over
+	// after every struct field or array element has been decoded.
+	ErrTooManyElements = errors.New("rlp: too many elements in list")
+	// ErrByteArrayLength is returned when a string doesn't have exactly
+	// the length of the byte array it's decoded into.
+	ErrByteArrayLength = errors.New("rlp: string length does not match byte array size")
+	// ErrInvalidBool is returned for a bool that isn't encoded as 0x80 or
+	// 0x01.
+	ErrInvalidBool = errors.New("rlp: invalid boolean value")
+	// ErrMoreThanOneValue is returned by DecodeBytes when the input has
+	// data left after the first item.
+	ErrMoreThanOneValue = errors.New("rlp: input contains more than one value")
+	// ErrEndOfList is returned by Stream when the current list has no
+	// more elements.
+	ErrEndOfList = errors.New("rlp: end of list")
+	// ErrNotConsumed is returned when a DecodeRLP method or a registered
+	// DecodeFunc leaves part of its item unread.
+	ErrNotConsumed = errors.New("rlp: decoder did not consume the entire item")
+
+	// ErrInputTooLarge is returned for input larger than
+	// DecodeOptions.MaxInputSize.
+	ErrInputTooLarge = errors.New("rlp: input exceeds size limit")
+	// ErrTooDeep is returned for lists nested deeper than
+	// DecodeOptions.MaxDepth.
+	ErrTooDeep = errors.New("rlp: nesting exceeds depth limit")
+	// ErrListTooLong is returned for a list with more elements than
+	// DecodeOptions.MaxListElems.
+	ErrListTooLong = errors.New("rlp: list exceeds element limit")
+	// ErrBigIntTooLarge is returned for an integer longer than
+	// DecodeOptions.MaxBigIntBits.
+	ErrBigIntTooLarge = errors.New("rlp: integer exceeds bit length limit")
+	// ErrSizeOverflow is returned by Decode for an item header whose
+	// size can't be represented as an int.
+	ErrSizeOverflow = errors.New("rlp: item size overflows int")
+)
+
+// DecodeError describes where decoding failed. Err is the underlying
+// error, usually one of the errors above, so errors.Is can be used to
+// check for a specific failure.
+type DecodeError struct {
+	Err error
+	// Offset is the position of the offending item within the input.
+	Offset int
+	// Path locates the value being decoded, e.g. Header.Number or [3].Data.
+	Path string
+}
+
+func (e *DecodeError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%v (offset %d)", e.Err, e.Offset)
+	}
+
+	return fmt.Sprintf("%v (offset %d, decoding %s)", e.Err, e.Offset, e.Path)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// wrapError adds ctx to the front of the path of err. If err doesn't carry
+// a position yet, it's wrapped in a DecodeError for the item at off.
+func wrapError(err error, off int, ctx string) error {
+	if de, ok := err.(*DecodeError); ok {
+		de.Path = ctx + de.Path
+		return de
+	}
+
+	return &DecodeError{Err: err, Offset: off, Path: ctx}
+}
+
+func indexPath(i int) string {
+	return "[" + strconv.Itoa(i) + "]"
+}
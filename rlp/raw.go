@@ -0,0 +1,11 @@
+package rlp
+
+import "reflect"
+
+// RawValue holds a complete encoded item, header included. It's written to
+// the output unchanged, and decoding into it captures the next item as is.
+// This makes it possible to defer decoding part of a value, or to pass
+// through data that isn't understood.
+type RawValue []byte
+
+var rawValueType = reflect.TypeOf(RawValue{})
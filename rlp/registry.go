@@ -0,0 +1,100 @@
+package rlp
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// EncodeFunc writes the encoding of v, a value of a registered type, to w.
+// Like EncodeRLP, it must write exactly one item.
+type EncodeFunc func(w io.Writer, v interface{}) error
+
+// DecodeFunc reads the next item from s into v, a pointer to a value of a
+// registered type. Like DecodeRLP, it must consume exactly one item.
+type DecodeFunc func(s *Stream, v interface{}) error
+
+// The registered funcs are read while encodeInfos and decoders are built,
+// so encodeFuncs is guarded by infoMu and decodeFuncs by decoderMu.
+var (
+	encodeFuncs = map[reflect.Type]EncodeFunc{}
+	decodeFuncs = map[reflect.Type]DecodeFunc{}
+)
+
+// Register makes values of typ encode with enc and decode with dec, taking
+// precedence over the rules for typ's kind and over EncodeRLP and DecodeRLP
+// methods. It's meant for types from other packages, which can't be given
+// those methods.
+//
+// A nil enc or dec leaves that direction to the default rules. Registering
+// typ again replaces both of its funcs, so a nil func also removes one
+// registered before, and Register(typ, nil, nil) undoes the registration.
+//
+// The funcs apply wherever a value of typ is found, including struct
+// fields and list elements, but not to pointers to typ: a nil *typ is still
+// the empty value of typ's kind. Slices and arrays of a byte type with a
+// registered enc encode as lists of items rather than strings, as they do
+// for byte types with an EncodeRLP method. Likewise, a registered dec makes
+// them decode from lists. Register both funcs for a byte type to have its
+// slices and arrays round-trip.
+//
+// Register is usually called from an init function. It's safe to call
+// while other goroutines encode and decode, which pick up the new funcs
+// for values they start on afterwards.
+func Register(typ reflect.Type, enc EncodeFunc, dec DecodeFunc) {
+	if typ == nil {
+		panic("rlp: Register of nil type")
+	}
+
+	infoMu.Lock()
+	defer infoMu.Unlock()
+	decoderMu.Lock()
+	defer decoderMu.Unlock()
+
+	if enc != nil {
+		encodeFuncs[typ] = enc
+	} else {
+		delete(encodeFuncs, typ)
+	}
+
+	if dec != nil {
+		decodeFuncs[typ] = dec
+	} else {
+		delete(decodeFuncs, typ)
+	}
+
+	// Cached encoders and decoders of types containing typ have the old
+	// behavior built in.
+	infoCache = map[reflect.Type]*encodeInfo{}
+	decoderCache = map[reflect.Type]*typeDecoder{}
+}
+
+func makeRegisteredFuncs(enc EncodeFunc) (sizer, writer) {
+	wr := func(v reflect.Value, w *encBuffer) error {
+		return enc(w, v.Interface())
+	}
+	return scratchFuncs(wr)
+}
+
+func makeRegisteredDecoder(dec DecodeFunc) decoder {
+	return func(buf *buffer, val reflect.Value) error {
+		if !val.CanAddr() {
+			return fmt.Errorf("rlp: unaddressable value of type %v, registered decoder needs a pointer", val.Type())
+		}
+
+		s, err := buf.itemStream()
+		if err != nil {
+			return err
+		}
+
+		if err := dec(s, val.Addr().Interface()); err != nil {
+			return err
+		}
+
+		if !s.consumed() {
+			return &DecodeError{Err: ErrNotConsumed, Offset: s.buf.offset()}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,228 @@
+package rlp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// regPoint has int fields, which aren't serializable without a registered
+// codec.
+type regPoint struct {
+	X, Y int
+}
+
+func encodeRegPoint(w io.Writer, v interface{}) error {
+	p := v.(regPoint)
+	if p.X < 0 || p.Y < 0 {
+		return fmt.Errorf("negative coordinate")
+	}
+	return Encode(w, []uint64{uint64(p.X), uint64(p.Y)})
+}
+
+func decodeRegPoint(s *Stream, v interface{}) error {
+	var xy [2]uint64
+	if err := s.Decode(&xy); err != nil {
+		return err
+	}
+	*v.(*regPoint) = regPoint{int(xy[0]), int(xy[1])}
+	return nil
+}
+
+type regShape struct {
+	Name   string
+	Points []regPoint
+	Origin *regPoint
+}
+
+func TestRegister(t *testing.T) {
+	shape := regShape{Name: "line", Points: []regPoint{{1, 2}, {3, 4}}, Origin: &regPoint{0, 0}}
+
+	// Looking the types up before registering caches their failure.
+	if _, err := EncodeToBytes(&shape); err == nil {
+		t.Fatalf("unregistered regPoint was encoded")
+	}
+	if err := DecodeBytes(unhex("C0"), new(regShape)); err == nil {
+		t.Fatalf("unregistered regPoint was decoded")
+	}
+
+	Register(reflect.TypeOf(regPoint{}), encodeRegPoint, decodeRegPoint)
+	defer Register(reflect.TypeOf(regPoint{}), nil, nil)
+
+	want := unhex("CF846C696E65C6C20102C20304C28080")
+	enc, err := EncodeToBytes(&shape)
+	if err != nil || !bytes.Equal(enc, want) {
+		t.Fatalf("EncodeToBytes: got (%X, %v), want %X", enc, err, want)
+	}
+	if size, err := EncodedSize(&shape); err != nil || size != len(want) {
+		t.Errorf("EncodedSize: got (%d, %v), want %d", size, err, len(want))
+	}
+
+	var dec regShape
+	if err := DecodeBytes(enc, &dec); err != nil {
+		t.Fatalf("DecodeBytes: %v", err)
+	}
+	if !reflect.DeepEqual(dec, shape) {
+		t.Errorf("DecodeBytes: got %+v, want %+v", dec, shape)
+	}
+
+	// Errors of the registered funcs are passed on.
+	shape.Points[1].X = -1
+	if _, err := EncodeToBytes(&shape); err == nil || err.Error() != "error with Points: failed to encode index 1: negative coordinate" {
+		t.Errorf("unexpected encoding error: %v", err)
+	}
+	if err := DecodeBytes(unhex("C9846C696E65C2C180C0"), &dec); !errors.Is(err, ErrTooFewElements) {
+		t.Errorf("expected ErrTooFewElements, got %v", err)
+	}
+}
+
+func TestRegisterOverridesMethods(t *testing.T) {
+	// byteEncoder has its own EncodeRLP method.
+	typ := reflect.TypeOf(byteEncoder(0))
+	val := []byteEncoder{1, 2}
+	if enc, _ := EncodeToBytes(val); !bytes.Equal(enc, unhex("C2C0C0")) {
+		t.Fatalf("EncodeRLP not used: %X", enc)
+	}
+
+	Register(typ, func(w io.Writer, v interface{}) error {
+		return Encode(w, uint(v.(byteEncoder)))
+	}, nil)
+	defer Register(typ, nil, nil)
+
+	if enc, err := EncodeToBytes(val); err != nil || !bytes.Equal(enc, unhex("C20102")) {
+		t.Fatalf("registered encoder not used: got (%X, %v)", enc, err)
+	}
+
+	// Without a registered decoder, decoding follows the default rules,
+	// which read a slice of a byte type as a string.
+	var dec []byteEncoder
+	if err := DecodeBytes(unhex("820102"), &dec); err != nil || !reflect.DeepEqual(dec, val) {
+		t.Fatalf("DecodeBytes: got (%v, %v)", dec, err)
+	}
+}
+
+// regByte is a byte type without methods.
+type regByte uint8
+
+func TestRegisterByteType(t *testing.T) {
+	typ := reflect.TypeOf(regByte(0))
+	if enc, _ := EncodeToBytes([]regByte{1, 2}); !bytes.Equal(enc, unhex("820102")) {
+		t.Fatalf("unregistered byte slice not encoded as a string: %X", enc)
+	}
+
+	// A registered byte type makes slices and arrays of it lists.
+	Register(typ, func(w io.Writer, v interface{}) error {
+		return Encode(w, uint(v.(regByte))+1)
+	}, func(s *Stream, v interface{}) error {
+		n, err := s.Uint64()
+		*v.(*regByte) = regByte(n - 1)
+		return err
+	})
+	defer Register(typ, nil, nil)
+
+	tests := []struct {
+		val, ptr interface{}
+	}{
+		{val: []regByte{1, 2}, ptr: new([]regByte)},
+		{val: [2]regByte{1, 2}, ptr: new([2]regByte)},
+	}
+	for _, test := range tests {
+		enc, err := EncodeToBytes(test.val)
+		if err != nil || !bytes.Equal(enc, unhex("C20203")) {
+			t.Errorf("%T: EncodeToBytes got (%X, %v)", test.val, enc, err)
+		}
+
+		if err := DecodeBytes(unhex("C20203"), test.ptr); err != nil {
+			t.Errorf("%T: DecodeBytes: %v", test.val, err)
+		} else if dec := reflect.ValueOf(test.ptr).Elem().Interface(); !reflect.DeepEqual(dec, test.val) {
+			t.Errorf("%T: DecodeBytes got %v", test.val, dec)
+		}
+	}
+
+	// Registering nil funcs restores the default rules.
+	Register(typ, nil, nil)
+	if enc, _ := EncodeToBytes([]regByte{1, 2}); !bytes.Equal(enc, unhex("820102")) {
+		t.Errorf("byte slice not encoded as a string after unregistering: %X", enc)
+	}
+	var dec []regByte
+	if err := DecodeBytes(unhex("820102"), &dec); err != nil || !reflect.DeepEqual(dec, []regByte{1, 2}) {
+		t.Errorf("byte slice not decoded from a string after unregistering: (%v, %v)", dec, err)
+	}
+}
+
+func TestRegisteredDecoderMustConsumeItem(t *testing.T) {
+	type partial struct{ A, B uint }
+	typ := reflect.TypeOf(partial{})
+	Register(typ, nil, func(s *Stream, v interface{}) error {
+		if _, err := s.List(); err != nil {
+			return err
+		}
+		a, err := s.Uint64()
+		v.(*partial).A = uint(a)
+		return err
+	})
+	defer Register(typ, nil, nil)
+
+	var p partial
+	err := DecodeBytes(unhex("C20102"), &p)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Err != ErrNotConsumed || de.Offset != 2 {
+		t.Errorf("expected ErrNotConsumed at offset 2 for a decoder that left a list open, got %v", err)
+	}
+}
+
+func TestRegisterTime(t *testing.T) {
+	type event struct {
+		Name string
+		At   time.Time
+	}
+	typ := reflect.TypeOf(time.Time{})
+	Register(typ, func(w io.Writer, v interface{}) error {
+		return Encode(w, uint64(v.(time.Time).Unix()))
+	}, func(s *Stream, v interface{}) error {
+		secs, err := s.Uint64()
+		if err != nil {
+			return err
+		}
+		*v.(*time.Time) = time.Unix(int64(secs), 0).UTC()
+		return nil
+	})
+	defer Register(typ, nil, nil)
+
+	ev := event{"launch", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	enc, err := EncodeToBytes(ev)
+	if err != nil || !bytes.Equal(enc, unhex("CC866C61756E6368845E0D5DA5")) {
+		t.Fatalf("EncodeToBytes: got (%X, %v)", enc, err)
+	}
+
+	var dec event
+	if err := DecodeBytes(enc, &dec); err != nil || dec != ev {
+		t.Fatalf("DecodeBytes: got (%v, %v), want %v", dec, err, ev)
+	}
+}
+
+func TestRegisterConcurrent(t *testing.T) {
+	typ := reflect.TypeOf(regPoint{})
+	defer Register(typ, nil, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				EncodeToBytes(&regShape{Points: []regPoint{{1, 2}}})
+				DecodeBytes(unhex("C6808080C28080"), new(regShape))
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		Register(typ, encodeRegPoint, decodeRegPoint)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,318 @@
+package rlp
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/rawfalafel/ethereum-toolbox/u256"
+)
+
+// Kind is the type of an encoded item.
+type Kind int
+
+const (
+	// Byte is a single byte below 0x80, which is its own encoding.
+	Byte Kind = iota
+	// String is a string with a header.
+	String
+	// List is a list of items.
+	List
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Byte:
+		return "Byte"
+	case String:
+		return "String"
+	case List:
+		return "List"
+	}
+
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Stream gives low-level access to encoded RLP, one item at a time, without
+// declaring Go types for it. It's also what Decoder implementations receive.
+//
+// Entering a list with List makes the stream read the list's elements until
+// ListEnd is called. Inside a list, running out of elements is reported as
+// ErrEndOfList. At the top level, io.EOF means the input is exhausted.
+type Stream struct {
+	// r supplies top-level items. It's nil if the stream reads from a
+	// byte slice.
+	r    io.Reader
+	opts *DecodeOptions
+
+	// buf holds the innermost open list, or the top-level input.
+	buf *buffer
+	// stack holds the buffers of the enclosing lists.
+	stack []*buffer
+	// elems counts the elements read from the innermost open list, and
+	// elemStack those of the enclosing lists.
+	elems     int
+	elemStack []int
+
+	// err is returned for every read if the input was rejected up front.
+	err error
+}
+
+// NewStream returns a Stream that reads items from r. Each top-level item
+// is read from r as a whole when the stream reaches it, and nothing past it
+// is consumed.
+func NewStream(r io.Reader) *Stream {
+	return defaultDecodeOptions.NewStream(r)
+}
+
+// NewByteStream returns a Stream over the items in data.
+func NewByteStream(data []byte) *Stream {
+	return defaultDecodeOptions.NewByteStream(data)
+}
+
+// NewStream is like the package-level NewStream, validating the input
+// according to opts.
+func (opts *DecodeOptions) NewStream(r io.Reader) *Stream {
+	return &Stream{r: r, opts: opts, buf: newBuffer(nil, opts)}
+}
+
+// NewByteStream is like the package-level NewByteStream, validating the
+// input according to opts. If data is larger than opts.MaxInputSize, every
+// read fails with ErrInputTooLarge.
+func (opts *DecodeOptions) NewByteStream(data []byte) *Stream {
+	s := &Stream{opts: opts, buf: newBuffer(data, opts)}
+	if opts.MaxInputSize > 0 && len(data) > opts.MaxInputSize {
+		s.err = &DecodeError{Err: ErrInputTooLarge}
+	}
+
+	return s
+}
+
+// next makes sure there's an item to read. At the top level of a stream
+// over a reader, it reads the next item from the reader.
+func (s *Stream) next() error {
+	if s.err != nil {
+		return s.err
+	}
+
+	if s.buf.idx < len(s.buf.dat) {
+		return nil
+	}
+
+	if len(s.stack) > 0 {
+		return ErrEndOfList
+	}
+
+	if s.r == nil {
+		return io.EOF
+	}
+
+	dat, err := readItem(s.r, s.opts.MaxInputSize)
+	if err != nil {
+		return err
+	}
+
+	base := s.buf.base + len(s.buf.dat)
+	s.buf = newBuffer(dat, s.opts)
+	s.buf.base = base
+	s.buf.alias = true
+	return nil
+}
+
+// item is like next, for methods that go on to consume the item. Inside a
+// list, it counts the item against DecodeOptions.MaxListElems.
+func (s *Stream) item() error {
+	if err := s.next(); err != nil {
+		return err
+	}
+
+	if len(s.stack) > 0 {
+		if err := s.buf.checkListLen(s.elems + 1); err != nil {
+			return &DecodeError{Err: err, Offset: s.buf.offset()}
+		}
+		s.elems++
+	}
+
+	return nil
+}
+
+// consumed reports whether a Stream from itemStream has been read to the
+// end, with no list left open.
+func (s *Stream) consumed() bool {
+	return len(s.stack) == 0 && s.buf.idx == len(s.buf.dat)
+}
+
+// Kind returns the kind of the next item and the size of its payload,
+// without consuming it.
+func (s *Stream) Kind() (Kind, int, error) {
+	if err := s.next(); err != nil {
+		return 0, 0, err
+	}
+
+	buf := s.buf
+	idx := buf.idx
+	defer func() { buf.idx = idx }()
+
+	off := buf.offset()
+	if b := buf.getCurrentSlice()[0]; b < 0x80 {
+		return Byte, 0, nil
+	} else if b < 0xc0 {
+		dat, err := buf.getBytes()
+		if err != nil {
+			return 0, 0, wrapError(err, off, "")
+		}
+		return String, len(dat), nil
+	}
+
+	dat, err := buf.getList()
+	if err != nil {
+		return 0, 0, wrapError(err, off, "")
+	}
+	return List, len(dat), nil
+}
+
+// List enters the next item, which must be a list, and returns the size of
+// its payload. Its elements are read until ListEnd is called.
+func (s *Stream) List() (int, error) {
+	if err := s.item(); err != nil {
+		return 0, err
+	}
+
+	off := s.buf.offset()
+	dat, err := s.buf.getList()
+	if err != nil {
+		return 0, wrapError(err, off, "")
+	}
+
+	s.stack = append(s.stack, s.buf)
+	s.buf = s.buf.sub(dat)
+	s.elemStack = append(s.elemStack, s.elems)
+	s.elems = 0
+	return len(dat), nil
+}
+
+// ListEnd leaves the current list. All of its elements must have been read.
+func (s *Stream) ListEnd() error {
+	if len(s.stack) == 0 {
+		return fmt.Errorf("rlp: ListEnd called outside of a list")
+	}
+
+	if s.buf.idx != len(s.buf.dat) {
+		return &DecodeError{Err: ErrTooManyElements, Offset: s.buf.offset()}
+	}
+
+	s.buf = s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	s.elems = s.elemStack[len(s.elemStack)-1]
+	s.elemStack = s.elemStack[:len(s.elemStack)-1]
+	return nil
+}
+
+// MoreDataInList reports whether the current list has elements left to
+// read. It's always false outside of a list.
+func (s *Stream) MoreDataInList() bool {
+	return len(s.stack) > 0 && s.buf.idx < len(s.buf.dat)
+}
+
+// Bytes reads the next item, which must be a string, and returns its
+// payload. Whether the result shares memory with the stream's input is
+// controlled by DecodeOptions.AliasInput.
+func (s *Stream) Bytes() ([]byte, error) {
+	if err := s.item(); err != nil {
+		return nil, err
+	}
+
+	off := s.buf.offset()
+	dat, err := s.buf.getBytes()
+	if err != nil {
+		return nil, wrapError(err, off, "")
+	}
+
+	return s.buf.result(dat), nil
+}
+
+// Uint64 reads the next item as an unsigned integer of at most 64 bits.
+func (s *Stream) Uint64() (uint64, error) {
+	if err := s.item(); err != nil {
+		return 0, err
+	}
+
+	off := s.buf.offset()
+	num, err := s.buf.getUint()
+	if err != nil {
+		return 0, wrapError(err, off, "")
+	}
+
+	return num, nil
+}
+
+// Bool reads the next item as a boolean, encoded as 0x01 for true and as
+// the empty string for false.
+func (s *Stream) Bool() (bool, error) {
+	if err := s.item(); err != nil {
+		return false, err
+	}
+
+	off := s.buf.offset()
+	b, err := s.buf.getBool()
+	if err != nil {
+		return false, wrapError(err, off, "")
+	}
+
+	return b, nil
+}
+
+// BigInt reads the next item as an arbitrary size unsigned integer.
+func (s *Stream) BigInt() (*big.Int, error) {
+	if err := s.item(); err != nil {
+		return nil, err
+	}
+
+	off := s.buf.offset()
+	dat, err := s.buf.getBigIntBytes()
+	if err != nil {
+		return nil, wrapError(err, off, "")
+	}
+
+	return new(big.Int).SetBytes(dat), nil
+}
+
+// ReadUint256 reads the next item as an unsigned integer of at most 256
+// bits into z.
+func (s *Stream) ReadUint256(z *u256.Uint256) error {
+	if err := s.item(); err != nil {
+		return err
+	}
+
+	off := s.buf.offset()
+	if err := s.buf.getUint256(z); err != nil {
+		return wrapError(err, off, "")
+	}
+
+	return nil
+}
+
+// Raw returns the next item in the stream, including its header. Like
+// Bytes, it aliases the input only if DecodeOptions.AliasInput allows it.
+func (s *Stream) Raw() ([]byte, error) {
+	if err := s.item(); err != nil {
+		return nil, err
+	}
+
+	off := s.buf.offset()
+	raw, err := s.buf.getRaw()
+	if err != nil {
+		return nil, wrapError(err, off, "")
+	}
+
+	return s.buf.result(raw), nil
+}
+
+// Decode decodes the next item in the stream into the value v points to.
+func (s *Stream) Decode(v interface{}) error {
+	if err := s.item(); err != nil {
+		return err
+	}
+
+	return s.buf.decodeValue(v)
+}
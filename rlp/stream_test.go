@@ -0,0 +1,252 @@
+package rlp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/rawfalafel/ethereum-toolbox/u256"
+)
+
+// streamInput is [ "dog", [ 1, 0x0400 ], 0x0102030405060708090a, [ [], "" ] ].
+const streamInput = "D783646F67C401820400" + "8A0102030405060708090A" + "C2C080"
+
+func checkStreamWalk(t *testing.T, s *Stream) {
+	expectKind := func(kind Kind, size int) {
+		t.Helper()
+		k, siz, err := s.Kind()
+		if err != nil || k != kind || siz != size {
+			t.Fatalf("Kind: got (%v, %d, %v), expected (%v, %d)", k, siz, err, kind, size)
+		}
+	}
+
+	expectKind(List, 23)
+	if size, err := s.List(); err != nil || size != 23 {
+		t.Fatalf("List: got (%d, %v)", size, err)
+	}
+
+	expectKind(String, 3)
+	if b, err := s.Bytes(); err != nil || string(b) != "dog" {
+		t.Fatalf("Bytes: got (%q, %v)", b, err)
+	}
+
+	expectKind(List, 4)
+	if _, err := s.List(); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	expectKind(Byte, 0)
+	if n, err := s.Uint64(); err != nil || n != 1 {
+		t.Fatalf("Uint64: got (%d, %v)", n, err)
+	}
+
+	if n, err := s.Uint64(); err != nil || n != 0x0400 {
+		t.Fatalf("Uint64: got (%d, %v)", n, err)
+	}
+
+	if _, _, err := s.Kind(); err != ErrEndOfList {
+		t.Fatalf("expected ErrEndOfList, got %v", err)
+	}
+
+	if _, err := s.Uint64(); err != ErrEndOfList {
+		t.Fatalf("expected ErrEndOfList, got %v", err)
+	}
+
+	if err := s.ListEnd(); err != nil {
+		t.Fatalf("ListEnd: %v", err)
+	}
+
+	if _, err := s.Uint64(); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("expected ErrValueTooLarge, got %v", err)
+	}
+
+	// The failed read consumed the integer, so Raw sees the last element.
+	raw, err := s.Raw()
+	if err != nil || !bytes.Equal(raw, unhex("C2C080")) {
+		t.Fatalf("Raw: got (%x, %v)", raw, err)
+	}
+
+	if err := s.ListEnd(); err != nil {
+		t.Fatalf("ListEnd: %v", err)
+	}
+}
+
+func TestStreamWalk(t *testing.T) {
+	checkStreamWalk(t, NewByteStream(unhex(streamInput)))
+	checkStreamWalk(t, NewStream(bytes.NewReader(unhex(streamInput))))
+}
+
+func TestStreamValues(t *testing.T) {
+	s := NewByteStream(unhex(streamInput))
+	if _, err := s.List(); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	var str string
+	if err := s.Decode(&str); err != nil || str != "dog" {
+		t.Fatalf("Decode: got (%q, %v)", str, err)
+	}
+
+	var nums []uint
+	if err := s.Decode(&nums); err != nil || len(nums) != 2 || nums[1] != 0x0400 {
+		t.Fatalf("Decode: got (%v, %v)", nums, err)
+	}
+
+	i, err := s.BigInt()
+	if expected, _ := new(big.Int).SetString("0102030405060708090a", 16); err != nil || i.Cmp(expected) != 0 {
+		t.Fatalf("BigInt: got (%v, %v)", i, err)
+	}
+
+	if err := s.ListEnd(); err == nil {
+		t.Fatalf("expected error from ListEnd before the end of the list")
+	}
+
+	if _, err := s.List(); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if _, err := s.Bytes(); !errors.Is(err, ErrExpectedString) {
+		t.Fatalf("expected ErrExpectedString, got %v", err)
+	}
+}
+
+func TestStreamTopLevel(t *testing.T) {
+	dat := unhex("05" + "C20102" + "83616263")
+	streams := map[string]*Stream{
+		"bytes":  NewByteStream(dat),
+		"reader": NewStream(bytes.NewReader(dat)),
+	}
+
+	for name, s := range streams {
+		if n, err := s.Uint64(); err != nil || n != 5 {
+			t.Errorf("%s: Uint64 got (%d, %v)", name, n, err)
+		}
+
+		if raw, err := s.Raw(); err != nil || !bytes.Equal(raw, unhex("C20102")) {
+			t.Errorf("%s: Raw got (%x, %v)", name, raw, err)
+		}
+
+		if err := s.ListEnd(); err == nil {
+			t.Errorf("%s: expected error from ListEnd outside of a list", name)
+		}
+
+		if _, _, err := s.Kind(); err != nil {
+			t.Errorf("%s: Kind: %v", name, err)
+		}
+
+		var str string
+		if err := s.Decode(&str); err != nil || str != "abc" {
+			t.Errorf("%s: Decode got (%q, %v)", name, str, err)
+		}
+
+		if _, _, err := s.Kind(); err != io.EOF {
+			t.Errorf("%s: expected io.EOF at the end of the input, got %v", name, err)
+		}
+	}
+
+	s := NewStream(bytes.NewReader(unhex("C3010203")))
+	if _, err := s.List(); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.Uint64(); err != nil {
+			t.Fatalf("Uint64: %v", err)
+		}
+	}
+
+	if _, err := s.Uint64(); err != ErrEndOfList {
+		t.Errorf("expected ErrEndOfList from a reader stream, got %v", err)
+	}
+
+	if _, err := NewStream(bytes.NewReader(unhex("C3"))).List(); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF for truncated input, got %v", err)
+	}
+}
+
+func TestStreamLimits(t *testing.T) {
+	// [ [ 1, 2 ], 3, 4 ]
+	dat := unhex("C5C20102" + "03" + "04")
+
+	opts := DecodeOptions{MaxInputSize: 5}
+	for name, s := range map[string]*Stream{
+		"bytes":  opts.NewByteStream(dat),
+		"reader": opts.NewStream(bytes.NewReader(dat)),
+	} {
+		if _, err := s.List(); !errors.Is(err, ErrInputTooLarge) {
+			t.Errorf("%s: expected ErrInputTooLarge, got %v", name, err)
+		}
+	}
+
+	opts = DecodeOptions{MaxListElems: 2}
+	for name, s := range map[string]*Stream{
+		"bytes":  opts.NewByteStream(dat),
+		"reader": opts.NewStream(bytes.NewReader(dat)),
+	} {
+		if _, err := s.List(); err != nil {
+			t.Fatalf("%s: List: %v", name, err)
+		}
+		if _, err := s.List(); err != nil {
+			t.Fatalf("%s: List: %v", name, err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := s.Uint64(); err != nil {
+				t.Fatalf("%s: Uint64: %v", name, err)
+			}
+		}
+		if err := s.ListEnd(); err != nil {
+			t.Fatalf("%s: ListEnd: %v", name, err)
+		}
+
+		// Leaving the inner list restores the count of the outer one.
+		if n, err := s.Uint64(); err != nil || n != 3 {
+			t.Errorf("%s: Uint64 got (%d, %v)", name, n, err)
+		}
+		if _, err := s.Uint64(); !errors.Is(err, ErrListTooLong) {
+			t.Errorf("%s: expected ErrListTooLong for the third element, got %v", name, err)
+		}
+	}
+}
+
+func TestStreamTypedReads(t *testing.T) {
+	// [ 1, "", 0x0102, 0x00ff ]
+	s := NewByteStream(unhex("C8" + "01" + "80" + "820102" + "8200FF"))
+	if s.MoreDataInList() {
+		t.Fatalf("MoreDataInList is true outside of a list")
+	}
+
+	if _, err := s.List(); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if b, err := s.Bool(); err != nil || !b {
+		t.Fatalf("Bool: got (%v, %v)", b, err)
+	}
+
+	if b, err := s.Bool(); err != nil || b {
+		t.Fatalf("Bool: got (%v, %v)", b, err)
+	}
+
+	var z u256.Uint256
+	if err := s.ReadUint256(&z); err != nil || z.Uint64() != 0x0102 {
+		t.Fatalf("ReadUint256: got (%v, %v)", z, err)
+	}
+
+	if !s.MoreDataInList() {
+		t.Fatalf("MoreDataInList is false before the last element")
+	}
+
+	if err := s.ReadUint256(&z); !errors.Is(err, ErrCanonInt) {
+		t.Fatalf("expected ErrCanonInt, got %v", err)
+	}
+
+	if s.MoreDataInList() {
+		t.Fatalf("MoreDataInList is true at the end of the list")
+	}
+
+	if _, err := NewByteStream(unhex("02")).Bool(); !errors.Is(err, ErrInvalidBool) {
+		t.Fatalf("expected ErrInvalidBool, got %v", err)
+	}
+}
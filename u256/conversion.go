@@ -0,0 +1,177 @@
+package u256
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrSyntax is returned when a string isn't a valid number.
+	ErrSyntax = errors.New("u256: invalid syntax")
+	// ErrOverflow is returned when a number doesn't fit in 256 bits.
+	ErrOverflow = errors.New("u256: value overflows 256 bits")
+)
+
+// FromHex parses s as a hexadecimal number with a "0x" or "0X" prefix.
+func FromHex(s string) (*Uint256, error) {
+	z := new(Uint256)
+	if err := z.setHex(s); err != nil {
+		return nil, err
+	}
+
+	return z, nil
+}
+
+// FromDecimal parses s as a decimal number.
+func FromDecimal(s string) (*Uint256, error) {
+	z := new(Uint256)
+	if err := z.setDecimal(s); err != nil {
+		return nil, err
+	}
+
+	return z, nil
+}
+
+func (z *Uint256) setHex(s string) error {
+	if len(s) < 3 || s[0] != '0' || (s[1] != 'x' && s[1] != 'X') {
+		return ErrSyntax
+	}
+
+	s = s[2:]
+	var res Uint256
+	for i := 0; i < len(s); i++ {
+		d, ok := hexDigit(s[i])
+		if !ok {
+			return ErrSyntax
+		}
+
+		if res[3]>>60 != 0 {
+			return ErrOverflow
+		}
+		res.Lsh(&res, 4)
+		res[0] |= uint64(d)
+	}
+
+	*z = res
+	return nil
+}
+
+func hexDigit(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+
+	return 0, false
+}
+
+func (z *Uint256) setDecimal(s string) error {
+	if len(s) == 0 {
+		return ErrSyntax
+	}
+
+	var res Uint256
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '0' || c > '9' {
+			return ErrSyntax
+		}
+
+		if res.mulAddSmall(10, uint64(c-'0')) != 0 {
+			return ErrOverflow
+		}
+	}
+
+	*z = res
+	return nil
+}
+
+// String returns z in decimal.
+func (z Uint256) String() string {
+	if z.IsUint64() {
+		return strconv.FormatUint(z[0], 10)
+	}
+
+	// Split off 19 digits at a time, the most that fit in a uint64.
+	const chunk = 10000000000000000000
+	var parts []string
+	x := z
+	for !x.IsZero() {
+		rem := x.divSmall(chunk)
+		if x.IsZero() {
+			parts = append(parts, strconv.FormatUint(rem, 10))
+		} else {
+			digits := strconv.FormatUint(rem, 10)
+			parts = append(parts, strings.Repeat("0", 19-len(digits))+digits)
+		}
+	}
+
+	var b strings.Builder
+	for i := len(parts) - 1; i >= 0; i-- {
+		b.WriteString(parts[i])
+	}
+
+	return b.String()
+}
+
+// Hex returns z as a hexadecimal number with a "0x" prefix and no leading
+// zeros, the way JSON-RPC encodes quantities.
+func (z Uint256) Hex() string {
+	if z.IsZero() {
+		return "0x0"
+	}
+
+	var b strings.Builder
+	b.WriteString("0x")
+	for i := 3; i >= 0; i-- {
+		if b.Len() == 2 {
+			if z[i] != 0 {
+				b.WriteString(strconv.FormatUint(z[i], 16))
+			}
+			continue
+		}
+
+		digits := strconv.FormatUint(z[i], 16)
+		b.WriteString(strings.Repeat("0", 16-len(digits)))
+		b.WriteString(digits)
+	}
+
+	return b.String()
+}
+
+// MarshalText encodes z the way Hex does.
+func (z Uint256) MarshalText() ([]byte, error) {
+	return []byte(z.Hex()), nil
+}
+
+// UnmarshalText accepts a hexadecimal number with a "0x" prefix or a
+// decimal number.
+func (z *Uint256) UnmarshalText(text []byte) error {
+	s := string(text)
+	if len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		return z.setHex(s)
+	}
+
+	return z.setDecimal(s)
+}
+
+// MarshalJSON encodes z as a JSON string holding its Hex form.
+func (z Uint256) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + z.Hex() + `"`), nil
+}
+
+// UnmarshalJSON accepts a JSON string in any format UnmarshalText takes,
+// or a plain JSON number without fraction or exponent.
+func (z *Uint256) UnmarshalJSON(input []byte) error {
+	s := string(input)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return z.UnmarshalText(input[1 : len(input)-1])
+	}
+
+	return z.setDecimal(s)
+}
@@ -0,0 +1,311 @@
+// Package u256 implements Uint256, a fixed-size 256-bit unsigned integer
+// for the many Ethereum quantities that fit in one: balances, values,
+// storage slots. Unlike big.Int it lives on the stack and never allocates.
+package u256
+
+import (
+	"encoding/binary"
+	"math/big"
+	"math/bits"
+)
+
+// Uint256 is an unsigned 256-bit integer, stored as four 64-bit words with
+// the least significant word first. Arithmetic wraps around modulo 2^256.
+// The zero value is 0.
+//
+// Like big.Int, the methods set the receiver to the result and return it,
+// so that calls can be chained. The receiver may alias the arguments.
+type Uint256 [4]uint64
+
+// NewUint256 returns a new Uint256 set to x.
+func NewUint256(x uint64) *Uint256 {
+	return &Uint256{x}
+}
+
+// FromBig returns b as a Uint256. It fails if b is negative or doesn't fit
+// in 256 bits.
+func FromBig(b *big.Int) (*Uint256, bool) {
+	if b.Sign() < 0 || b.BitLen() > 256 {
+		return nil, false
+	}
+
+	var buf [32]byte
+	return new(Uint256).SetBytes(b.FillBytes(buf[:])), true
+}
+
+// SetUint64 sets z to x and returns z.
+func (z *Uint256) SetUint64(x uint64) *Uint256 {
+	*z = Uint256{x}
+	return z
+}
+
+// SetBytes interprets b as a big-endian number, sets z to it and returns z.
+// Only the last 32 bytes of b are used.
+func (z *Uint256) SetBytes(b []byte) *Uint256 {
+	if len(b) > 32 {
+		b = b[len(b)-32:]
+	}
+
+	*z = Uint256{}
+	for i, j := len(b)-1, uint(0); i >= 0; i, j = i-1, j+1 {
+		z[j/8] |= uint64(b[i]) << (8 * (j % 8))
+	}
+
+	return z
+}
+
+// Uint64 returns the low 64 bits of z.
+func (z *Uint256) Uint64() uint64 {
+	return z[0]
+}
+
+// IsUint64 reports whether z fits in a uint64.
+func (z *Uint256) IsUint64() bool {
+	return z[1]|z[2]|z[3] == 0
+}
+
+// IsZero reports whether z is 0.
+func (z *Uint256) IsZero() bool {
+	return z[0]|z[1]|z[2]|z[3] == 0
+}
+
+// BitLen returns the number of bits needed to represent z.
+func (z *Uint256) BitLen() int {
+	for i := 3; i >= 0; i-- {
+		if z[i] != 0 {
+			return i*64 + bits.Len64(z[i])
+		}
+	}
+
+	return 0
+}
+
+// ByteLen returns the number of bytes needed to represent z.
+func (z *Uint256) ByteLen() int {
+	return (z.BitLen() + 7) / 8
+}
+
+// Cmp compares z and x and returns -1, 0 or +1.
+func (z *Uint256) Cmp(x *Uint256) int {
+	for i := 3; i >= 0; i-- {
+		switch {
+		case z[i] < x[i]:
+			return -1
+		case z[i] > x[i]:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// Eq reports whether z equals x.
+func (z *Uint256) Eq(x *Uint256) bool {
+	return *z == *x
+}
+
+// Add sets z to x+y, wrapping around on overflow, and returns z.
+func (z *Uint256) Add(x, y *Uint256) *Uint256 {
+	z.AddOverflow(x, y)
+	return z
+}
+
+// AddOverflow sets z to x+y, wrapping around on overflow, and returns z
+// and whether it overflowed.
+func (z *Uint256) AddOverflow(x, y *Uint256) (*Uint256, bool) {
+	var carry uint64
+	z[0], carry = bits.Add64(x[0], y[0], 0)
+	z[1], carry = bits.Add64(x[1], y[1], carry)
+	z[2], carry = bits.Add64(x[2], y[2], carry)
+	z[3], carry = bits.Add64(x[3], y[3], carry)
+	return z, carry != 0
+}
+
+// Sub sets z to x-y, wrapping around on underflow, and returns z.
+func (z *Uint256) Sub(x, y *Uint256) *Uint256 {
+	z.SubOverflow(x, y)
+	return z
+}
+
+// SubOverflow sets z to x-y, wrapping around on underflow, and returns z
+// and whether it underflowed.
+func (z *Uint256) SubOverflow(x, y *Uint256) (*Uint256, bool) {
+	var borrow uint64
+	z[0], borrow = bits.Sub64(x[0], y[0], 0)
+	z[1], borrow = bits.Sub64(x[1], y[1], borrow)
+	z[2], borrow = bits.Sub64(x[2], y[2], borrow)
+	z[3], borrow = bits.Sub64(x[3], y[3], borrow)
+	return z, borrow != 0
+}
+
+// Mul sets z to x*y, modulo 2^256, and returns z.
+func (z *Uint256) Mul(x, y *Uint256) *Uint256 {
+	var res Uint256
+	for i := 0; i < 4; i++ {
+		var carry uint64
+		for j := 0; i+j < 4; j++ {
+			hi, lo := bits.Mul64(x[i], y[j])
+			var c uint64
+			lo, c = bits.Add64(lo, res[i+j], 0)
+			hi += c
+			lo, c = bits.Add64(lo, carry, 0)
+			hi += c
+			res[i+j] = lo
+			carry = hi
+		}
+	}
+
+	*z = res
+	return z
+}
+
+// Div sets z to x/y, rounded towards zero, and returns z. Dividing by zero
+// gives zero, as in the EVM.
+func (z *Uint256) Div(x, y *Uint256) *Uint256 {
+	q, _ := divRem(x, y)
+	*z = q
+	return z
+}
+
+// Mod sets z to x%y and returns z. Modulo zero gives zero, as in the EVM.
+func (z *Uint256) Mod(x, y *Uint256) *Uint256 {
+	_, r := divRem(x, y)
+	*z = r
+	return z
+}
+
+func divRem(x, y *Uint256) (q, r Uint256) {
+	if y.IsZero() {
+		return q, r
+	}
+
+	if y.IsUint64() {
+		q = *x
+		r[0] = q.divSmall(y[0])
+		return q, r
+	}
+
+	// Binary long division. y has more than 64 bits, so the quotient
+	// has at most 192 and this is rarely a long loop.
+	shift := x.BitLen() - y.BitLen()
+	if shift < 0 {
+		return q, *x
+	}
+
+	r = *x
+	d := new(Uint256).Lsh(y, uint(shift))
+	for i := shift; i >= 0; i-- {
+		if r.Cmp(d) >= 0 {
+			r.Sub(&r, d)
+			q[i/64] |= 1 << uint(i%64)
+		}
+		d.Rsh(d, 1)
+	}
+
+	return q, r
+}
+
+// divSmall divides z by d in place and returns the remainder.
+func (z *Uint256) divSmall(d uint64) uint64 {
+	var rem uint64
+	for i := 3; i >= 0; i-- {
+		z[i], rem = bits.Div64(rem, z[i], d)
+	}
+
+	return rem
+}
+
+// mulAddSmall sets z to z*m+a and returns the part of the result that
+// doesn't fit in 256 bits.
+func (z *Uint256) mulAddSmall(m, a uint64) uint64 {
+	carry := a
+	for i := 0; i < 4; i++ {
+		hi, lo := bits.Mul64(z[i], m)
+		var c uint64
+		z[i], c = bits.Add64(lo, carry, 0)
+		carry = hi + c
+	}
+
+	return carry
+}
+
+// Lsh sets z to x<<n, dropping bits shifted out, and returns z.
+func (z *Uint256) Lsh(x *Uint256, n uint) *Uint256 {
+	var res Uint256
+	if n < 256 {
+		words, shift := int(n/64), n%64
+		for i := 3; i >= words; i-- {
+			res[i] = x[i-words] << shift
+			if shift > 0 && i-words > 0 {
+				res[i] |= x[i-words-1] >> (64 - shift)
+			}
+		}
+	}
+
+	*z = res
+	return z
+}
+
+// Rsh sets z to x>>n and returns z.
+func (z *Uint256) Rsh(x *Uint256, n uint) *Uint256 {
+	var res Uint256
+	if n < 256 {
+		words, shift := int(n/64), n%64
+		for i := 0; i+words < 4; i++ {
+			res[i] = x[i+words] >> shift
+			if shift > 0 && i+words < 3 {
+				res[i] |= x[i+words+1] << (64 - shift)
+			}
+		}
+	}
+
+	*z = res
+	return z
+}
+
+// FillBytes sets buf to the big-endian bytes of z, zero-padded on the left,
+// and returns buf. It panics if z doesn't fit in buf.
+func (z *Uint256) FillBytes(buf []byte) []byte {
+	if len(buf) < z.ByteLen() {
+		panic("u256: buffer too small to fit value")
+	}
+
+	end := len(buf)
+	for i := 0; i < 4 && end > 0; i++ {
+		if end >= 8 {
+			binary.BigEndian.PutUint64(buf[end-8:end], z[i])
+			end -= 8
+			continue
+		}
+
+		// Only the low bytes of the last word fit, and they hold all
+		// of it.
+		for j := 0; end > 0; j++ {
+			end--
+			buf[end] = byte(z[i] >> uint(8*j))
+		}
+	}
+	for i := 0; i < end; i++ {
+		buf[i] = 0
+	}
+
+	return buf
+}
+
+// Bytes returns the big-endian bytes of z, without leading zeros.
+func (z *Uint256) Bytes() []byte {
+	return z.FillBytes(make([]byte, z.ByteLen()))
+}
+
+// Bytes32 returns the big-endian bytes of z, zero-padded to 32 bytes.
+func (z *Uint256) Bytes32() [32]byte {
+	var b [32]byte
+	z.FillBytes(b[:])
+	return b
+}
+
+// ToBig returns z as a big.Int.
+func (z *Uint256) ToBig() *big.Int {
+	b := z.Bytes32()
+	return new(big.Int).SetBytes(b[:])
+}
@@ -0,0 +1,220 @@
+package u256
+
+import (
+	"encoding/json"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+var two256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// randUint256 returns a random value, favoring the edge cases of empty and
+// full words.
+func randUint256(rnd *rand.Rand) *Uint256 {
+	var z Uint256
+	for i := range z {
+		switch rnd.Intn(4) {
+		case 0:
+		case 1:
+			z[i] = ^uint64(0)
+		default:
+			z[i] = rnd.Uint64()
+		}
+	}
+	return &z
+}
+
+func TestArithmetic(t *testing.T) {
+	ops := []struct {
+		name string
+		f    func(z, x, y *Uint256) *Uint256
+		big  func(x, y *big.Int) *big.Int
+	}{
+		{"Add", (*Uint256).Add, func(x, y *big.Int) *big.Int { return new(big.Int).Add(x, y) }},
+		{"Sub", (*Uint256).Sub, func(x, y *big.Int) *big.Int { return new(big.Int).Sub(x, y) }},
+		{"Mul", (*Uint256).Mul, func(x, y *big.Int) *big.Int { return new(big.Int).Mul(x, y) }},
+		{"Div", (*Uint256).Div, func(x, y *big.Int) *big.Int {
+			if y.Sign() == 0 {
+				return new(big.Int)
+			}
+			return new(big.Int).Div(x, y)
+		}},
+		{"Mod", (*Uint256).Mod, func(x, y *big.Int) *big.Int {
+			if y.Sign() == 0 {
+				return new(big.Int)
+			}
+			return new(big.Int).Mod(x, y)
+		}},
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		x, y := randUint256(rnd), randUint256(rnd)
+		for _, op := range ops {
+			want := op.big(x.ToBig(), y.ToBig())
+			want.Mod(want, two256)
+
+			got := op.f(new(Uint256), x, y)
+			if got.ToBig().Cmp(want) != 0 {
+				t.Fatalf("%s(%s, %s) = %s, want %s", op.name, x.Hex(), y.Hex(), got.Hex(), want.Text(16))
+			}
+
+			// The receiver may alias an argument.
+			z := *x
+			if op.f(&z, &z, y); z != *got {
+				t.Fatalf("%s with aliased receiver = %s, want %s", op.name, z.Hex(), got.Hex())
+			}
+		}
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	max := &Uint256{^uint64(0), ^uint64(0), ^uint64(0), ^uint64(0)}
+	one := NewUint256(1)
+
+	if z, overflow := new(Uint256).AddOverflow(max, one); !overflow || !z.IsZero() {
+		t.Errorf("max+1 = %s, overflow %t", z, overflow)
+	}
+	if z, overflow := new(Uint256).SubOverflow(new(Uint256), one); !overflow || *z != *max {
+		t.Errorf("0-1 = %s, overflow %t", z, overflow)
+	}
+	if _, overflow := new(Uint256).AddOverflow(one, one); overflow {
+		t.Errorf("1+1 overflowed")
+	}
+}
+
+func TestShift(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	for i := 0; i < 1000; i++ {
+		x := randUint256(rnd)
+		n := uint(rnd.Intn(300))
+
+		want := new(big.Int).Lsh(x.ToBig(), n)
+		want.Mod(want, two256)
+		if got := new(Uint256).Lsh(x, n); got.ToBig().Cmp(want) != 0 {
+			t.Fatalf("%s << %d = %s, want %x", x.Hex(), n, got.Hex(), want)
+		}
+
+		want = new(big.Int).Rsh(x.ToBig(), n)
+		if got := new(Uint256).Rsh(x, n); got.ToBig().Cmp(want) != 0 {
+			t.Fatalf("%s >> %d = %s, want %x", x.Hex(), n, got.Hex(), want)
+		}
+	}
+}
+
+func TestBigConversion(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	for i := 0; i < 1000; i++ {
+		x := randUint256(rnd)
+		y, ok := FromBig(x.ToBig())
+		if !ok || *y != *x {
+			t.Fatalf("round trip of %s through big.Int gave %v", x.Hex(), y)
+		}
+		if b := x.Bytes(); len(b) != x.ByteLen() || new(big.Int).SetBytes(b).Cmp(x.ToBig()) != 0 {
+			t.Fatalf("Bytes of %s = %x", x.Hex(), b)
+		}
+	}
+
+	if _, ok := FromBig(big.NewInt(-1)); ok {
+		t.Errorf("FromBig accepted a negative number")
+	}
+	if _, ok := FromBig(two256); ok {
+		t.Errorf("FromBig accepted 2^256")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		hex   string
+		err   error
+	}{
+		{input: "0", hex: "0x0"},
+		{input: "0x0", hex: "0x0"},
+		{input: "1234", hex: "0x4d2"},
+		{input: "0xff", hex: "0xff"},
+		{input: "0XFF", hex: "0xff"},
+		{input: "0x00ff", hex: "0xff"},
+		{input: "18446744073709551616", hex: "0x10000000000000000"},
+		{
+			input: "115792089237316195423570985008687907853269984665640564039457584007913129639935",
+			hex:   "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		},
+		{
+			input: "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			hex:   "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		},
+		{input: "115792089237316195423570985008687907853269984665640564039457584007913129639936", err: ErrOverflow},
+		{input: "0x1ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", err: ErrOverflow},
+		{input: "", err: ErrSyntax},
+		{input: "0x", err: ErrSyntax},
+		{input: "0xg", err: ErrSyntax},
+		{input: "-1", err: ErrSyntax},
+		{input: "1.5", err: ErrSyntax},
+	}
+
+	for _, test := range tests {
+		var z Uint256
+		err := z.UnmarshalText([]byte(test.input))
+		if err != test.err {
+			t.Errorf("%q: got error %v, want %v", test.input, err, test.err)
+			continue
+		}
+		if err == nil && z.Hex() != test.hex {
+			t.Errorf("%q: got %s, want %s", test.input, z.Hex(), test.hex)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	rnd := rand.New(rand.NewSource(4))
+	for i := 0; i < 1000; i++ {
+		x := randUint256(rnd)
+		if got, want := x.String(), x.ToBig().String(); got != want {
+			t.Fatalf("String() = %s, want %s", got, want)
+		}
+		y, err := FromDecimal(x.String())
+		if err != nil || *y != *x {
+			t.Fatalf("FromDecimal(%s) = %v, %v", x, y, err)
+		}
+		y, err = FromHex(x.Hex())
+		if err != nil || *y != *x {
+			t.Fatalf("FromHex(%s) = %v, %v", x.Hex(), y, err)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type account struct {
+		Balance Uint256
+		Nonce   *Uint256
+	}
+
+	acc := account{Balance: Uint256{0, 1}, Nonce: NewUint256(5)}
+	enc, err := json.Marshal(acc)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if want := `{"Balance":"0x10000000000000000","Nonce":"0x5"}`; string(enc) != want {
+		t.Errorf("got %s, want %s", enc, want)
+	}
+
+	var dec account
+	if err := json.Unmarshal(enc, &dec); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if dec.Balance != acc.Balance || *dec.Nonce != *acc.Nonce {
+		t.Errorf("round trip gave %v", dec)
+	}
+
+	if err := json.Unmarshal([]byte(`{"Balance":"1000","Nonce":42}`), &dec); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if dec.Balance.Uint64() != 1000 || dec.Nonce.Uint64() != 42 {
+		t.Errorf("got %v", dec)
+	}
+	if err := json.Unmarshal([]byte(`{"Balance":-1}`), &dec); err == nil {
+		t.Errorf("negative number accepted")
+	}
+}